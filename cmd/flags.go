@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"flag"
+	"strings"
+)
+
+// listFlag is a flag that can be repeated, every value may also hold a comma
+// separated list. Setting the flag replaces its default.
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func newListFlag(name, value, usage string) *[]string {
+	f := &listFlag{}
+	f.values = splitList(value)
+	flag.Var(f, name, usage)
+	return &f.values
+}
+
+func (f *listFlag) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	if !f.set {
+		f.values, f.set = nil, true
+	}
+	f.values = append(f.values, splitList(value)...)
+	return nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"errors"
 	"flag"
@@ -9,36 +10,100 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/LiskHQ/lsk-faucet/internal/alert"
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
 	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
 	"github.com/LiskHQ/lsk-faucet/internal/server"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
 )
 
 var (
 	appVersion = "v1.1.0"
-	chainIDMap = map[string]int{"lisk_sepolia": 4202}
 
 	tokenAddress      = flag.String("token.address", os.Getenv("ERC20_TOKEN_ADDRESS"), "Contract address of ERC20 token")
 	tokenDecimalsFlag = flag.Int("token.decimals", 18, "Token decimals")
+	tokenRegistryFlag = flag.String("token.registry", os.Getenv("TOKEN_REGISTRY"), "YAML or JSON file listing the tokens to serve, overrides the single token flags")
+	tokenStrictFlag   = flag.Bool("token.strict", false, "Refuse to start when the configured token symbol or decimals disagree with the contract")
 
 	httpPortFlag = flag.Int("httpport", 8080, "Listener port to serve HTTP connection")
 	proxyCntFlag = flag.Int("proxycount", 0, "Count of reverse proxies in front of the server")
 	versionFlag  = flag.Bool("version", false, "Print version number")
 
-	payoutFlag   = flag.Float64("faucet.amount", 0.1, "Number of ERC20 tokens to transfer per user request")
+	payoutFlag   = flag.String("faucet.amount", "0.1", "Number of ERC20 tokens to transfer per user request")
 	intervalFlag = flag.Int("faucet.minutes", 10080, "Number of minutes to wait between funding rounds")
-	netnameFlag  = flag.String("faucet.name", "lisk_sepolia", "Network name to display on the frontend")
+	netnameFlag  = flag.String("faucet.name", "lisk_sepolia", "Network to serve, looked up in the network registry, and its name to display on the frontend")
 	symbolFlag   = flag.String("faucet.symbol", "LSK", "Token symbol to display on the frontend")
 
-	explorerURL    = flag.String("explorer.url", "https://sepolia-blockscout.lisk.com", "Block explorer URL")
+	maxBalanceFlag = flag.String("faucet.maxbalance", "", "Maximum token balance of a recipient, empty for no limit")
+	modeFlag       = flag.String("faucet.mode", registry.ModeTransfer, "Pay out tokens by transfer from the faucet balance or by mint, for tokens the faucet account may mint")
+	topUpFlag      = flag.Bool("faucet.topup", false, "Treat the token payout as a target balance and only send the difference")
+	tiersFlag      = flag.String("faucet.tiers", "", "Comma separated reserve:scale tiers scaling the payout down as the faucet reserve drops, e.g. 1000:0.5,100:0.1")
+	floorFlag      = flag.String("faucet.floor", "", "Faucet token reserve below which claims are paused, empty to never pause")
+
+	hourlyClaimsFlag = flag.Int("budget.claims.hourly", 0, "Maximum number of claims of all users per hour, 0 for no limit")
+	dailyClaimsFlag  = flag.Int("budget.claims.daily", 0, "Maximum number of claims of all users per day, 0 for no limit")
+	hourlyTokensFlag = flag.String("budget.tokens.hourly", "", "Maximum number of tokens paid out per hour, empty for no limit")
+	dailyTokensFlag  = flag.String("budget.tokens.daily", "", "Maximum number of tokens paid out per day, empty for no limit")
+
+	nativePayoutFlag   = flag.String("faucet.native.amount", "0", "Number of native coins to transfer per user request, 0 to disable")
+	nativeIntervalFlag = flag.Int("faucet.native.minutes", 10080, "Number of minutes to wait between native coin funding rounds")
+	nativeSymbolFlag   = flag.String("faucet.native.symbol", "ETH", "Native coin symbol to display on the frontend")
+	nativeBundleFlag   = flag.Bool("faucet.native.bundle", false, "Send the native coin payout along with every token claim")
+	nativeMaxBalFlag   = flag.String("faucet.native.maxbalance", "", "Maximum native coin balance of a recipient, empty for no limit")
+	nativeTopUpFlag    = flag.Bool("faucet.native.topup", false, "Treat the native coin payout as a target balance and only send the difference")
+
+	maxFeeFlag   = flag.Float64("tx.maxfee", 0, "Maximum fee per gas in gwei the faucet is willing to pay, 0 for no cap")
+	maxTipFlag   = flag.Float64("tx.maxtip", 0, "Maximum priority fee per gas in gwei, 0 for no cap")
+	legacyTxFlag = flag.Bool("tx.legacy", false, "Send legacy transactions for networks without EIP-1559 support")
+	stuckFlag    = flag.Duration("tx.stucktimeout", 3*time.Minute, "Time after which a pending transaction is replaced with bumped fees, 0 to disable")
+	maxBumpFlag  = flag.Float64("tx.replace.maxfee", 0, "Maximum fee per gas in gwei for replacement transactions, 0 for no cap")
+	gasMultFlag  = flag.Float64("tx.gasmultiplier", 1.2, "Safety multiplier applied to the estimated gas of token transfers")
+	gasCapFlag   = flag.Uint64("tx.gascap", 200000, "Maximum gas limit of a token transfer")
+	confirmsFlag = flag.Uint64("tx.confirmations", 1, "Number of blocks after which a claim transaction is reported as confirmed")
+
+	storeFlag       = flag.String("limiter.store", "bolt", "Storage of the rate limits: bolt (on-disk, survives restarts), redis (shared by replicas) or memory")
+	storePathFlag   = flag.String("limiter.path", "lsk-faucet.db", "File of the bolt rate limit store")
+	redisURLFlag    = flag.String("limiter.redis.url", os.Getenv("REDIS_URL"), "URL of the redis rate limit store, e.g. redis://localhost:6379/0")
+	redisPrefixFlag = flag.String("limiter.redis.prefix", "lsk-faucet", "Prefix of the rate limit keys in redis, shared by all replicas")
+
+	indexWindowFlag   = flag.Uint64("indexer.blocks", 302400, "Number of recent blocks scanned for past claims on startup, 0 to disable (302400 is one week of 2s blocks)")
+	indexIntervalFlag = flag.Duration("indexer.interval", 10*time.Minute, "Interval between scans of new blocks for claims, 0 to scan only on startup")
+
+	queueWorkersFlag = flag.Int("claim.workers", 4, "Number of workers sending queued claims")
+	queueSizeFlag    = flag.Int("claim.queue", 1000, "Number of claims waiting to be sent before new claims are refused")
+	batchFlag        = flag.String("claim.batch.contract", "", "Disperse contract paying out queued claims in batches, empty to send every claim on its own")
+	batchWindowFlag  = flag.Duration("claim.batch.window", 3*time.Second, "Time during which queued claims are collected into a batch")
+	batchSizeFlag    = flag.Int("claim.batch.size", 100, "Maximum number of claims paid out in one batch")
+
+	alertWebhooksFlag = flag.String("alert.webhooks", os.Getenv("ALERT_WEBHOOKS"), "Comma separated webhooks notified of alerts, as url or format=url with format generic, slack or discord")
+	alertIntervalFlag = flag.Duration("alert.interval", time.Minute, "Interval between checks of the faucet balances")
+	alertRepeatFlag   = flag.Duration("alert.repeat", 6*time.Hour, "Interval after which an alert that persists is sent again, 0 to send it once")
+	alertTokenFlag    = flag.String("alert.token.threshold", "", "Token balance of the faucet below which an alert fires, empty to disable")
+	alertNativeFlag   = flag.String("alert.native.threshold", "", "Native coin balance of the faucet below which an alert fires, empty to disable")
+	alertFailuresFlag = flag.Int("alert.failures", 3, "Number of consecutive failed claims that fire an alert, 0 to disable")
+
+	treasuryFlag         = flag.String("treasury.address", "", "Treasury account that approved the faucet account to refill it, empty to disable")
+	treasuryIntervalFlag = flag.Duration("treasury.interval", time.Minute, "Interval between checks of the faucet balances for refills")
+	refillBelowFlag      = flag.String("treasury.refill.below", "", "Token balance of the faucet below which it is refilled from the treasury")
+	refillAmountFlag     = flag.String("treasury.refill.amount", "", "Number of tokens pulled from the treasury per refill")
+
+	networkRegistryFlag = flag.String("network.registry", os.Getenv("NETWORK_REGISTRY"), "YAML or JSON file listing networks in addition to the bundled ones, replacing bundled networks of the same name")
+
+	explorerURL    = flag.String("explorer.url", "", "Block explorer URL, defaults to the explorer of the network")
 	explorerTxPath = flag.String("explorer.tx.path", "tx", "Block explorer transaction path fragment")
 
-	keyJSONFlag  = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with")
+	keyJSONFlag  = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file, or directory whose keyfiles all fund user requests")
 	keyPassFlag  = flag.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore")
-	privKeyFlag  = flag.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with")
-	providerFlag = flag.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Lisk JSON-RPC connection")
+	privKeyFlag  = newListFlag("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with, repeat the flag or separate keys with commas for a pool of funding accounts")
+	providerFlag = newListFlag("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Lisk JSON-RPC connection, repeat the flag or separate endpoints with commas to fail over between them")
 
 	hcaptchaSiteKeyFlag = flag.String("hcaptcha.sitekey", os.Getenv("HCAPTCHA_SITEKEY"), "hCaptcha sitekey")
 	hcaptchaSecretFlag  = flag.String("hcaptcha.secret", os.Getenv("HCAPTCHA_SECRET"), "hCaptcha secret")
@@ -53,39 +118,331 @@ func init() {
 }
 
 func Execute() {
-	privateKey, err := getPrivateKeyFromFlags()
+	privateKeys, err := getPrivateKeysFromFlags()
 	if err != nil {
 		panic(fmt.Errorf("failed to read private key: %w", err))
 	}
-	var chainID *big.Int
-	if value, ok := chainIDMap[strings.ToLower(*netnameFlag)]; ok {
-		chainID = big.NewInt(int64(value))
+	chainID, err := applyNetwork()
+	if err != nil {
+		panic(fmt.Errorf("failed to read network configuration: %w", err))
 	}
 
-	txBuilder, err := chain.NewTxBuilder(*providerFlag, privateKey, *tokenAddress, chainID)
+	tokens, err := getTokensFromFlags()
 	if err != nil {
-		panic(fmt.Errorf("cannot connect to web3 provider: %w", err))
+		panic(fmt.Errorf("failed to read token configuration: %w", err))
+	}
+	tokenAddresses := make([]string, len(tokens))
+	for i, token := range tokens {
+		tokenAddresses[i] = token.Address
 	}
-	config := server.NewConfig(*netnameFlag, *symbolFlag, *payoutFlag, *tokenDecimalsFlag, *httpPortFlag, *intervalFlag, *proxyCntFlag, *hcaptchaSiteKeyFlag, *hcaptchaSecretFlag, *explorerURL, *explorerTxPath)
-	go server.NewServer(txBuilder, config).Run()
+
+	txBuilder, err := chain.NewTxBuilder(*providerFlag, privateKeys, tokenAddresses, chainID,
+		chain.WithFeeCaps(gweiFlagToWei(*maxFeeFlag), gweiFlagToWei(*maxTipFlag)),
+		chain.WithLegacyTx(*legacyTxFlag),
+		chain.WithConfirmations(*confirmsFlag),
+		chain.WithGasEstimation(*gasMultFlag, *gasCapFlag),
+		chain.WithStuckTxReplacement(*stuckFlag, gweiFlagToWei(*maxBumpFlag)),
+	)
+	if err != nil {
+		panic(fmt.Errorf("cannot set up web3 provider: %w", err))
+	}
+	log.WithFields(log.Fields{
+		"network": *netnameFlag,
+		"chainID": txBuilder.ChainID(),
+	}).Info("Verified chain ID of the web3 provider")
+	if err = resolveTokenMetadata(txBuilder, tokens); err != nil {
+		panic(fmt.Errorf("failed to read token metadata: %w", err))
+	}
+	if err = checkMinters(txBuilder, tokens); err != nil {
+		panic(fmt.Errorf("failed to verify mint permission: %w", err))
+	}
+	var batchContract common.Address
+	if *batchFlag != "" {
+		if !chain.IsValidAddress(*batchFlag, false) {
+			panic(fmt.Errorf("invalid disperse contract address %q", *batchFlag))
+		}
+		batchContract = common.HexToAddress(*batchFlag)
+		approveDisperse(txBuilder, tokens, batchContract)
+	}
+	nativePayout, err := chain.ParseUnits(*nativePayoutFlag, 18)
+	if err != nil {
+		panic(fmt.Errorf("invalid native coin payout: %w", err))
+	}
+	var nativeMaxBalance *big.Int
+	if *nativeMaxBalFlag != "" {
+		if nativeMaxBalance, err = chain.ParseUnits(*nativeMaxBalFlag, 18); err != nil {
+			panic(fmt.Errorf("invalid native coin max balance: %w", err))
+		}
+	}
+	config := server.NewConfig(*netnameFlag, tokens, *httpPortFlag, *proxyCntFlag, *hcaptchaSiteKeyFlag, *hcaptchaSecretFlag, *explorerURL, *explorerTxPath).
+		WithNativePayout(*nativeSymbolFlag, nativePayout, *nativeIntervalFlag, *nativeBundleFlag).
+		WithNativeBalanceLimit(nativeMaxBalance, *nativeTopUpFlag).
+		WithClaimBudgets(*hourlyClaimsFlag, *dailyClaimsFlag).
+		WithClaimQueue(*queueWorkersFlag, *queueSizeFlag).
+		WithBatching(batchContract, *batchWindowFlag, *batchSizeFlag)
+	limitStore, err := newLimitStore()
+	if err != nil {
+		panic(fmt.Errorf("failed to open rate limit store: %w", err))
+	}
+	defer limitStore.Close()
+	if *indexWindowFlag > 0 {
+		go server.NewIndexer(txBuilder, limitStore, config, *indexWindowFlag, *indexIntervalFlag).Run(context.Background())
+	}
+	webhooks, err := parseWebhooks(*alertWebhooksFlag)
+	if err != nil {
+		panic(fmt.Errorf("failed to configure alerts: %w", err))
+	}
+	notifier := alert.NewNotifier(webhooks, fmt.Sprintf("%s faucet %s", *netnameFlag, txBuilder.Sender().Hex()), *alertRepeatFlag)
+	// The monitor also polls the balances reported by /api/info, alerts are
+	// only logged without webhooks
+	monitor, err := newMonitor(txBuilder, config, notifier)
+	if err != nil {
+		panic(fmt.Errorf("failed to configure alerts: %w", err))
+	}
+	go monitor.Run(context.Background())
+	if *treasuryFlag != "" {
+		if !chain.IsValidAddress(*treasuryFlag, false) {
+			panic(fmt.Errorf("invalid treasury address %q", *treasuryFlag))
+		}
+		go server.NewRefiller(txBuilder, config, common.HexToAddress(*treasuryFlag), notifier, *treasuryIntervalFlag).Run(context.Background())
+	}
+	go server.NewServer(txBuilder, limitStore, config).WithMonitor(monitor).Run()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
 }
 
-func getPrivateKeyFromFlags() (*ecdsa.PrivateKey, error) {
-	if *privKeyFlag != "" {
-		hexkey := *privKeyFlag
-		if chain.Has0xPrefix(hexkey) {
-			hexkey = hexkey[2:]
+func newLimitStore() (store.Store, error) {
+	switch *storeFlag {
+	case "bolt":
+		return store.NewBoltStore(*storePathFlag)
+	case "redis":
+		return store.NewRedisStore(*redisURLFlag, *redisPrefixFlag)
+	case "memory":
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", *storeFlag)
+	}
+}
+
+// parseWebhooks parses a comma separated list of alert webhooks.
+func parseWebhooks(value string) ([]alert.Webhook, error) {
+	var webhooks []alert.Webhook
+	for _, value := range splitList(value) {
+		webhook, err := alert.ParseWebhook(value)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func newMonitor(txBuilder chain.TxBuilder, config *server.Config, notifier *alert.Notifier) (*server.Monitor, error) {
+	var nativeThreshold *big.Int
+	if *alertNativeFlag != "" {
+		var err error
+		if nativeThreshold, err = chain.ParseUnits(*alertNativeFlag, 18); err != nil {
+			return nil, fmt.Errorf("invalid native alert threshold: %w", err)
+		}
+	}
+	return server.NewMonitor(txBuilder, config, notifier, *alertIntervalFlag, nativeThreshold, *alertFailuresFlag), nil
+}
+
+func getTokensFromFlags() ([]registry.Token, error) {
+	if *tokenRegistryFlag != "" {
+		tokens, err := registry.LoadTokens(*tokenRegistryFlag)
+		if err != nil {
+			return nil, err
+		}
+		// The mode and interval flags are the defaults of tokens that do not set one
+		for i := range tokens {
+			if tokens[i].Mode == "" {
+				tokens[i].Mode = *modeFlag
+			}
+			if tokens[i].Interval == registry.IntervalUnset {
+				tokens[i].Interval = *intervalFlag
+			}
+		}
+		return tokens, nil
+	}
+
+	tiers, err := registry.ParseTiers(*tiersFlag)
+	if err != nil {
+		return nil, err
+	}
+	// Symbol and decimals left at their defaults are read from the contract
+	token := registry.Token{
+		Address:      *tokenAddress,
+		Decimals:     registry.DecimalsUnset,
+		Payout:       *payoutFlag,
+		Interval:     *intervalFlag,
+		MaxBalance:   *maxBalanceFlag,
+		TopUp:        *topUpFlag,
+		Tiers:        tiers,
+		Floor:        *floorFlag,
+		HourlyBudget: *hourlyTokensFlag,
+		DailyBudget:  *dailyTokensFlag,
+		AlertBelow:   *alertTokenFlag,
+		RefillBelow:  *refillBelowFlag,
+		RefillAmount: *refillAmountFlag,
+		Mode:         *modeFlag,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "faucet.symbol":
+			token.Symbol = *symbolFlag
+		case "token.decimals":
+			token.Decimals = *tokenDecimalsFlag
 		}
-		return crypto.HexToECDSA(hexkey)
+	})
+	return []registry.Token{token}, nil
+}
+
+// resolveTokenMetadata reads the symbol, name and decimals of every token from
+// its contract. When a contract does not expose them, the configured values are
+// kept, falling back to the flag defaults for a single token.
+func resolveTokenMetadata(txBuilder chain.TxBuilder, tokens []registry.Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for i := range tokens {
+		token := &tokens[i]
+		meta, err := readTokenMetadata(ctx, txBuilder.GetContractInstance(common.HexToAddress(token.Address)))
+		if err == nil {
+			if err = token.ApplyMetadata(meta, *tokenStrictFlag); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if *tokenRegistryFlag == "" {
+			if token.Symbol == "" {
+				token.Symbol = *symbolFlag
+			}
+			if token.Decimals == registry.DecimalsUnset {
+				token.Decimals = *tokenDecimalsFlag
+			}
+		}
+		if token.Symbol == "" || token.Decimals == registry.DecimalsUnset {
+			return fmt.Errorf("token %s: %w, configure its symbol and decimals explicitly", token.Address, err)
+		}
+		log.WithError(err).WithField("token", token.Address).Warn("Failed to read token metadata, using the configured values")
+	}
+
+	return registry.ValidateTokens(tokens)
+}
+
+// checkMinters verifies that the faucet account may mint every token in mint
+// mode, so the faucet does not start with payouts that always fail.
+func checkMinters(txBuilder chain.TxBuilder, tokens []registry.Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, token := range tokens {
+		if !token.Minted() {
+			continue
+		}
+		if err := txBuilder.CheckMinter(ctx, common.HexToAddress(token.Address)); err != nil {
+			return fmt.Errorf("token %s: %w", token.Symbol, err)
+		}
+	}
+	return nil
+}
+
+// approveDisperse approves the disperse contract to spend the transferred
+// tokens. Batches of a token that is not approved fail their simulation and
+// their claims are sent one by one, so a failed approval is only logged.
+func approveDisperse(txBuilder chain.TxBuilder, tokens []registry.Token, disperse common.Address) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, token := range tokens {
+		if token.Minted() {
+			continue
+		}
+		if err := txBuilder.ApproveDisperse(ctx, disperse, common.HexToAddress(token.Address)); err != nil {
+			log.WithError(err).WithField("token", token.Symbol).Warn("failed to approve disperse contract")
+		}
+	}
+}
+
+func readTokenMetadata(ctx context.Context, token *bindings.Token) (registry.Metadata, error) {
+	if token == nil {
+		return registry.Metadata{}, errors.New("unknown token")
+	}
+	opts := &bind.CallOpts{Context: ctx}
+	decimals, err := token.Decimals(opts)
+	if err != nil {
+		return registry.Metadata{}, err
+	}
+	symbol, err := token.Symbol(opts)
+	if err != nil {
+		return registry.Metadata{}, err
+	}
+	// The name is optional in the ERC20 standard and only used for display
+	name, err := token.Name(opts)
+	if err != nil {
+		log.WithError(err).Debug("Token does not expose a name")
+	}
+	return registry.Metadata{Name: name, Symbol: symbol, Decimals: int(decimals)}, nil
+}
+
+// applyNetwork looks the network selected by -faucet.name up in the network
+// registry and uses its settings for every network flag that was not set. It
+// returns the chain ID of the network, or nil for a network missing from the
+// registry, in which case the chain ID is taken from the providers.
+func applyNetwork() (*big.Int, error) {
+	networks, err := registry.LoadNetworks(*networkRegistryFlag)
+	if err != nil {
+		return nil, err
+	}
+	network, ok := networks.Lookup(*netnameFlag)
+	if !ok {
+		log.WithField("network", *netnameFlag).Warn("network is not in the network registry, using the chain id of the providers")
+		return nil, nil
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if len(*providerFlag) == 0 {
+		*providerFlag = network.RPCURLs
+	}
+	if *tokenAddress == "" {
+		*tokenAddress = network.Token
+	}
+	if !set["explorer.url"] {
+		*explorerURL = network.ExplorerURL
+	}
+	if !set["explorer.tx.path"] && network.ExplorerTxPath != "" {
+		*explorerTxPath = network.ExplorerTxPath
+	}
+	if !set["faucet.native.symbol"] && network.NativeSymbol != "" {
+		*nativeSymbolFlag = network.NativeSymbol
+	}
+	return new(big.Int).SetUint64(network.ChainID), nil
+}
+
+func getPrivateKeysFromFlags() ([]*ecdsa.PrivateKey, error) {
+	if len(*privKeyFlag) > 0 {
+		privateKeys := make([]*ecdsa.PrivateKey, 0, len(*privKeyFlag))
+		for _, hexkey := range *privKeyFlag {
+			if chain.Has0xPrefix(hexkey) {
+				hexkey = hexkey[2:]
+			}
+			privateKey, err := crypto.HexToECDSA(hexkey)
+			if err != nil {
+				return nil, err
+			}
+			privateKeys = append(privateKeys, privateKey)
+		}
+		return privateKeys, nil
 	} else if *keyJSONFlag == "" {
 		return nil, errors.New("missing private key or keystore")
 	}
 
-	keyfile, err := chain.ResolveKeyfilePath(*keyJSONFlag)
+	keyfiles, err := chain.ResolveKeyfilePaths(*keyJSONFlag)
 	if err != nil {
 		return nil, err
 	}
@@ -94,5 +451,20 @@ func getPrivateKeyFromFlags() (*ecdsa.PrivateKey, error) {
 		return nil, err
 	}
 
-	return chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+	privateKeys := make([]*ecdsa.PrivateKey, 0, len(keyfiles))
+	for _, keyfile := range keyfiles {
+		privateKey, err := chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyfile, err)
+		}
+		privateKeys = append(privateKeys, privateKey)
+	}
+	return privateKeys, nil
+}
+
+func gweiFlagToWei(gwei float64) *big.Int {
+	if gwei <= 0 {
+		return nil
+	}
+	return chain.GweiToWei(gwei)
 }
@@ -0,0 +1,149 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Payload formats of webhooks.
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatDiscord = "discord"
+)
+
+// Webhook is an endpoint notified of alerts in one of the payload formats.
+type Webhook struct {
+	URL    string
+	Format string
+}
+
+// ParseWebhook parses a webhook written as format=url, such as
+// slack=https://hooks.slack.com/services/..., a plain URL uses the generic
+// JSON format.
+func ParseWebhook(value string) (Webhook, error) {
+	format, url, ok := strings.Cut(value, "=")
+	if !ok || strings.Contains(format, "/") {
+		format, url = FormatGeneric, value
+	}
+	switch format {
+	case FormatGeneric, FormatSlack, FormatDiscord:
+	default:
+		return Webhook{}, fmt.Errorf("unknown webhook format %q", format)
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return Webhook{}, fmt.Errorf("invalid webhook url %q", url)
+	}
+	return Webhook{URL: url, Format: format}, nil
+}
+
+// Notifier sends alerts to webhooks. An alert is identified by a key and is
+// only sent again after it was resolved or once the repeat interval passed,
+// so a condition that persists does not flood the channels.
+type Notifier struct {
+	mutex    sync.Mutex
+	client   *http.Client
+	webhooks []Webhook
+	source   string
+	repeat   time.Duration
+	active   map[string]time.Time
+}
+
+// NewNotifier creates a notifier for alerts about source, such as the faucet
+// account. A zero repeat interval notifies an alert only once until resolved.
+func NewNotifier(webhooks []Webhook, source string, repeat time.Duration) *Notifier {
+	return &Notifier{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		webhooks: webhooks,
+		source:   source,
+		repeat:   repeat,
+		active:   make(map[string]time.Time),
+	}
+}
+
+// Fire notifies the alert key with message unless it is already active.
+func (n *Notifier) Fire(ctx context.Context, key, message string) {
+	n.mutex.Lock()
+	firedAt, ok := n.active[key]
+	if ok && (n.repeat <= 0 || time.Since(firedAt) < n.repeat) {
+		n.mutex.Unlock()
+		return
+	}
+	n.active[key] = time.Now()
+	n.mutex.Unlock()
+
+	log.WithField("alert", key).Warn(message)
+	n.notify(ctx, key, "firing", message)
+}
+
+// Resolve notifies that the alert key recovered with message, if it fired.
+func (n *Notifier) Resolve(ctx context.Context, key, message string) {
+	n.mutex.Lock()
+	_, ok := n.active[key]
+	delete(n.active, key)
+	n.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	log.WithField("alert", key).Info(message)
+	n.notify(ctx, key, "resolved", message)
+}
+
+func (n *Notifier) notify(ctx context.Context, key, status, message string) {
+	for _, webhook := range n.webhooks {
+		if err := n.post(ctx, webhook, payload(webhook.Format, key, status, n.source, message)); err != nil {
+			log.WithError(err).WithField("alert", key).Error("failed to send alert webhook")
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, webhook Webhook, body interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// payload formats an alert for a webhook. Slack and Discord only render a
+// text message, the generic format carries every field.
+func payload(format, key, status, source, message string) interface{} {
+	text := fmt.Sprintf("[%s] %s: %s", strings.ToUpper(status), source, message)
+	switch format {
+	case FormatSlack:
+		return map[string]string{"text": text}
+	case FormatDiscord:
+		return map[string]string{"content": text}
+	default:
+		return map[string]string{
+			"alert":   key,
+			"status":  status,
+			"source":  source,
+			"message": message,
+			"time":    time.Now().UTC().Format(time.RFC3339),
+		}
+	}
+}
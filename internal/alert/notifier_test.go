@@ -0,0 +1,107 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mutex    sync.Mutex
+	payloads []map[string]string
+}
+
+func (r *recorder) server(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		r.mutex.Lock()
+		r.payloads = append(r.payloads, body)
+		r.mutex.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Webhook
+		wantErr bool
+	}{
+		{name: "plain url", value: "https://example.com/hook?token=abc", want: Webhook{URL: "https://example.com/hook?token=abc", Format: FormatGeneric}},
+		{name: "slack", value: "slack=https://hooks.slack.com/services/T/B/X", want: Webhook{URL: "https://hooks.slack.com/services/T/B/X", Format: FormatSlack}},
+		{name: "discord", value: "discord=https://discord.com/api/webhooks/1/x", want: Webhook{URL: "https://discord.com/api/webhooks/1/x", Format: FormatDiscord}},
+		{name: "unknown format", value: "teams=https://example.com", wantErr: true},
+		{name: "invalid url", value: "slack=example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWebhook(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNotifier_Payloads(t *testing.T) {
+	generic, slack, discord := &recorder{}, &recorder{}, &recorder{}
+	notifier := NewNotifier([]Webhook{
+		{URL: generic.server(t).URL, Format: FormatGeneric},
+		{URL: slack.server(t).URL, Format: FormatSlack},
+		{URL: discord.server(t).URL, Format: FormatDiscord},
+	}, "faucet", 0)
+
+	notifier.Fire(context.Background(), "low-balance", "balance is low")
+
+	require.Len(t, generic.payloads, 1)
+	assert.Equal(t, "low-balance", generic.payloads[0]["alert"])
+	assert.Equal(t, "firing", generic.payloads[0]["status"])
+	assert.Equal(t, "faucet", generic.payloads[0]["source"])
+	assert.Equal(t, "balance is low", generic.payloads[0]["message"])
+	require.Len(t, slack.payloads, 1)
+	assert.Equal(t, "[FIRING] faucet: balance is low", slack.payloads[0]["text"])
+	require.Len(t, discord.payloads, 1)
+	assert.Equal(t, "[FIRING] faucet: balance is low", discord.payloads[0]["content"])
+}
+
+func TestNotifier_Deduplication(t *testing.T) {
+	hook := &recorder{}
+	notifier := NewNotifier([]Webhook{{URL: hook.server(t).URL, Format: FormatGeneric}}, "faucet", 0)
+	bgCtx := context.Background()
+
+	notifier.Resolve(bgCtx, "low-balance", "never fired")
+	notifier.Fire(bgCtx, "low-balance", "balance is low")
+	notifier.Fire(bgCtx, "low-balance", "balance is still low")
+	notifier.Fire(bgCtx, "claim-failures", "claims fail")
+	require.Len(t, hook.payloads, 2)
+
+	notifier.Resolve(bgCtx, "low-balance", "balance recovered")
+	notifier.Fire(bgCtx, "low-balance", "balance is low again")
+	require.Len(t, hook.payloads, 4)
+	assert.Equal(t, "resolved", hook.payloads[2]["status"])
+	assert.Equal(t, "firing", hook.payloads[3]["status"])
+}
+
+func TestNotifier_Repeat(t *testing.T) {
+	hook := &recorder{}
+	notifier := NewNotifier([]Webhook{{URL: hook.server(t).URL, Format: FormatGeneric}}, "faucet", time.Millisecond)
+	bgCtx := context.Background()
+
+	notifier.Fire(bgCtx, "low-balance", "balance is low")
+	time.Sleep(2 * time.Millisecond)
+	notifier.Fire(bgCtx, "low-balance", "balance is still low")
+	assert.Len(t, hook.payloads, 2)
+}
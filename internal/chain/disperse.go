@@ -0,0 +1,106 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
+)
+
+// disperseAllowanceFloor is the allowance below which the disperse contract
+// is approved again. Approvals are for the maximum amount, so they are only
+// renewed once a large share of it was spent.
+var disperseAllowanceFloor = new(big.Int).Rsh(math.MaxBig256, 1)
+
+var errEmptyBatch = errors.New("batch without recipients")
+
+// DisperseETH pays values of the native coin to recipients in a single
+// transaction through the disperse contract.
+func (b *TxBuild) DisperseETH(ctx context.Context, disperse common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	total, err := batchTotal(recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	data, err := disperseData("disperseEther", recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return b.sendBatchFromPool(ctx, b.candidates(), disperse, total, data, len(recipients))
+}
+
+// DisperseERC20 pays values of token to recipients in a single transaction
+// through the disperse contract, which must be approved to spend the tokens
+// of the sending account, see ApproveDisperse. Accounts that did not approve
+// it fail the simulation and are skipped.
+func (b *TxBuild) DisperseERC20(ctx context.Context, disperse, token common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error) {
+	if _, err := batchTotal(recipients, values); err != nil {
+		return common.Hash{}, err
+	}
+	data, err := disperseData("disperseToken", token, recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return b.sendBatchFromPool(ctx, b.candidates(), disperse, nil, data, len(recipients))
+}
+
+// ApproveDisperse approves the disperse contract to spend the tokens of every
+// funding account whose allowance runs low. The approvals are only sent, a
+// batch sent before they are mined fails its simulation.
+func (b *TxBuild) ApproveDisperse(ctx context.Context, disperse, token common.Address) error {
+	data := approveData(disperse, math.MaxBig256)
+	for _, w := range b.wallets {
+		allowance, err := b.Allowance(ctx, token, w.address, disperse)
+		if err != nil {
+			return err
+		}
+		if allowance.Cmp(disperseAllowanceFloor) >= 0 {
+			continue
+		}
+		txHash, err := b.sendFromPool(ctx, []*wallet{w}, token, nil, data)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"txHash":   txHash,
+			"account":  w.address,
+			"token":    token,
+			"disperse": disperse,
+		}).Info("approved disperse contract")
+	}
+	return nil
+}
+
+func batchTotal(recipients []common.Address, values []*big.Int) (*big.Int, error) {
+	if len(recipients) == 0 {
+		return nil, errEmptyBatch
+	}
+	if len(recipients) != len(values) {
+		return nil, errors.New("batch recipients and values differ in length")
+	}
+	total := new(big.Int)
+	for _, value := range values {
+		total.Add(total, value)
+	}
+	return total, nil
+}
+
+func disperseData(method string, args ...interface{}) ([]byte, error) {
+	disperseABI, err := bindings.DisperseMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return disperseABI.Pack(method, args...)
+}
+
+func approveData(spender common.Address, value *big.Int) []byte {
+	var data []byte
+	data = append(data, methodID("approve(address,uint256)")...)
+	data = append(data, addLeftPadding(spender.Bytes())...)
+	data = append(data, addLeftPadding(value.Bytes())...)
+	return data
+}
@@ -0,0 +1,139 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
+)
+
+var testRecipients = []common.Address{
+	common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+	common.HexToAddress("0x71562b71999873DB5b286dF957af199Ec94617F7"),
+}
+
+func TestTxBuilder_DisperseETH(t *testing.T) {
+	txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+	bgCtx := context.Background()
+	values := []*big.Int{big.NewInt(1000), big.NewInt(2000)}
+
+	txHash, err := txBuilder.DisperseETH(bgCtx, testTokenAddress, testRecipients, values)
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(3000), tx.Value())
+	args := unpackDisperse(t, "disperseEther", tx.Data())
+	assert.Equal(t, testRecipients, args[0])
+	assert.Equal(t, values, args[1])
+}
+
+func TestTxBuilder_DisperseERC20(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       []byte
+		values     []*big.Int
+		wantErr    bool
+		wantRevert bool
+	}{
+		{name: "batch is sent", code: mockTokenCode, values: []*big.Int{big.NewInt(1000), big.NewInt(2000)}},
+		{name: "reverting batch is not sent", code: revertingTokenCode, values: []*big.Int{big.NewInt(1000), big.NewInt(2000)}, wantErr: true, wantRevert: true},
+		{name: "values must match recipients", code: mockTokenCode, values: []*big.Int{big.NewInt(1000)}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			txBuilder, simBackend := newTestTokenBuilder(t, tc.code)
+			bgCtx := context.Background()
+			token := common.HexToAddress("0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D")
+
+			txHash, err := txBuilder.DisperseERC20(bgCtx, testTokenAddress, token, testRecipients, tc.values)
+			if tc.wantErr {
+				require.Error(t, err)
+				if tc.wantRevert {
+					var revertErr *RevertError
+					assert.ErrorAs(t, err, &revertErr)
+				}
+				return
+			}
+			require.NoError(t, err)
+			simBackend.Commit()
+
+			tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+			require.NoError(t, err)
+			assert.Equal(t, testTokenAddress, *tx.To())
+			args := unpackDisperse(t, "disperseToken", tx.Data())
+			assert.Equal(t, token, args[0])
+			assert.Equal(t, testRecipients, args[1])
+			assert.Equal(t, tc.values, args[2])
+		})
+	}
+}
+
+func TestTxBuilder_DisperseGasCap(t *testing.T) {
+	// The calldata of 30 recipients alone costs more than the gas cap of a
+	// transfer, but less than the cap of the batch
+	txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+	txBuilder.gasCap = 30000
+	bgCtx := context.Background()
+	token := common.HexToAddress("0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D")
+	recipients := make([]common.Address, 30)
+	values := make([]*big.Int, len(recipients))
+	for i := range recipients {
+		recipients[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		values[i] = big.NewInt(1000)
+	}
+
+	txHash, err := txBuilder.DisperseERC20(bgCtx, testTokenAddress, token, recipients, values)
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Greater(t, tx.Gas(), txBuilder.gasCap)
+	assert.LessOrEqual(t, tx.Gas(), txBuilder.gasCap*uint64(len(recipients)))
+	receipt, err := simBackend.Client().TransactionReceipt(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+
+	// A batch is not sent with the static gas limit of a single transfer
+	txBuilder.client = &noEstimateClient{Client: simBackend.Client()}
+	_, err = txBuilder.DisperseERC20(bgCtx, testTokenAddress, token, recipients, values)
+	assert.Error(t, err)
+}
+
+func TestTxBuilder_ApproveDisperse(t *testing.T) {
+	// The mock token reports an allowance of 1, far below the floor
+	txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+	bgCtx := context.Background()
+	disperse := common.HexToAddress("0xD152f549545093347A162Dce210e7293f1452150")
+
+	require.NoError(t, txBuilder.ApproveDisperse(bgCtx, disperse, testTokenAddress))
+	simBackend.Commit()
+
+	block, err := simBackend.Client().BlockByNumber(bgCtx, big.NewInt(1))
+	require.NoError(t, err)
+	require.Len(t, block.Transactions(), 1)
+	data := block.Transactions()[0].Data()
+	require.Len(t, data, 4+2*32)
+	assert.Equal(t, hexutil.MustDecode("0x095ea7b3"), data[:4])
+	assert.Equal(t, disperse, common.BytesToAddress(data[4:36]))
+	assert.Equal(t, math.MaxBig256, new(big.Int).SetBytes(data[36:]))
+}
+
+func unpackDisperse(t *testing.T, method string, data []byte) []interface{} {
+	disperseABI, err := bindings.DisperseMetaData.GetAbi()
+	require.NoError(t, err)
+	require.Equal(t, disperseABI.Methods[method].ID, data[:4])
+	args, err := disperseABI.Methods[method].Inputs.Unpack(data[4:])
+	require.NoError(t, err)
+	return args
+}
@@ -0,0 +1,105 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var errNoBaseFee = errors.New("latest block has no base fee, enable legacy transactions for this network")
+
+// txFees holds the gas price fields of a transaction. Legacy transactions only
+// use gasPrice, dynamic fee transactions use gasTipCap and gasFeeCap.
+type txFees struct {
+	gasPrice  *big.Int
+	gasTipCap *big.Int
+	gasFeeCap *big.Int
+}
+
+func (f *txFees) newTx(chainID *big.Int, nonce uint64, to common.Address, value *big.Int, gas uint64, data []byte) *types.Transaction {
+	if f.gasPrice != nil {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			To:       &to,
+			Value:    value,
+			Gas:      gas,
+			GasPrice: f.gasPrice,
+			Data:     data,
+		})
+	}
+
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		To:        &to,
+		Value:     value,
+		Gas:       gas,
+		GasTipCap: f.gasTipCap,
+		GasFeeCap: f.gasFeeCap,
+		Data:      data,
+	})
+}
+
+// maxCost returns the most a transaction with gas and value can cost its
+// sender.
+func (f *txFees) maxCost(gas uint64, value *big.Int) *big.Int {
+	price := f.gasFeeCap
+	if f.gasPrice != nil {
+		price = f.gasPrice
+	}
+	cost := new(big.Int).Mul(price, new(big.Int).SetUint64(gas))
+	if value != nil {
+		cost.Add(cost, value)
+	}
+	return cost
+}
+
+// suggestFees returns the fees for a new transaction. The suggested tip is
+// capped at maxTipCap and the fee cap, twice the latest base fee plus the tip,
+// is capped at maxFeeCap. It fails instead of underpricing a transaction when
+// the network fee is above the configured caps.
+func (b *TxBuild) suggestFees(ctx context.Context) (*txFees, error) {
+	if b.legacyTx {
+		gasPrice, err := b.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if b.maxFeeCap != nil && gasPrice.Cmp(b.maxFeeCap) > 0 {
+			return nil, fmt.Errorf("network gas price %s exceeds the configured fee cap %s", gasPrice, b.maxFeeCap)
+		}
+		return &txFees{gasPrice: gasPrice}, nil
+	}
+
+	head, err := b.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, errNoBaseFee
+	}
+	if b.maxFeeCap != nil && head.BaseFee.Cmp(b.maxFeeCap) > 0 {
+		return nil, fmt.Errorf("network base fee %s exceeds the configured fee cap %s", head.BaseFee, b.maxFeeCap)
+	}
+
+	gasTipCap, err := b.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.maxTipCap != nil && gasTipCap.Cmp(b.maxTipCap) > 0 {
+		gasTipCap = new(big.Int).Set(b.maxTipCap)
+	}
+
+	gasFeeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), gasTipCap)
+	if b.maxFeeCap != nil && gasFeeCap.Cmp(b.maxFeeCap) > 0 {
+		gasFeeCap = new(big.Int).Set(b.maxFeeCap)
+	}
+	if gasTipCap.Cmp(gasFeeCap) > 0 {
+		gasTipCap = new(big.Int).Set(gasFeeCap)
+	}
+
+	return &txFees{gasTipCap: gasTipCap, gasFeeCap: gasFeeCap}, nil
+}
@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxBuilder_DynamicFees(t *testing.T) {
+	testcases := []struct {
+		name      string
+		maxFeeCap *big.Int
+		maxTipCap *big.Int
+		wantErr   bool
+	}{
+		{
+			name: "should use network fees when caps are not configured",
+		},
+		{
+			name:      "should cap the priority fee",
+			maxTipCap: big.NewInt(1),
+		},
+		{
+			name:      "should cap the fee per gas",
+			maxFeeCap: big.NewInt(1500000000),
+		},
+		{
+			name:      "should refuse to send when the base fee exceeds the fee cap",
+			maxFeeCap: big.NewInt(1),
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			txBuilder, simBackend := newTestTxBuilder(t)
+			txBuilder.maxFeeCap = tc.maxFeeCap
+			txBuilder.maxTipCap = tc.maxTipCap
+			bgCtx := context.Background()
+			toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+			txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			simBackend.Commit()
+
+			tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+			require.NoError(t, err)
+			assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+			assert.True(t, tx.GasTipCap().Cmp(tx.GasFeeCap()) <= 0)
+			if tc.maxTipCap != nil {
+				assert.True(t, tx.GasTipCap().Cmp(tc.maxTipCap) <= 0)
+			}
+			if tc.maxFeeCap != nil {
+				assert.True(t, tx.GasFeeCap().Cmp(tc.maxFeeCap) <= 0)
+			}
+		})
+	}
+}
+
+func TestTxBuilder_LegacyFees(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	txBuilder.legacyTx = true
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(types.LegacyTxType), tx.Type())
+
+	txBuilder.maxFeeCap = big.NewInt(1)
+	_, err = txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	assert.Error(t, err)
+}
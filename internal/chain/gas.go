@@ -0,0 +1,153 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
+)
+
+var (
+	defaultGasMultiplier        = 1.2
+	defaultGasCap        uint64 = 200000
+)
+
+// RevertError is returned when the simulation of a transaction reverts, so the
+// transaction is never broadcast.
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return "transaction would revert"
+	}
+	return fmt.Sprintf("transaction would revert: %s", e.Reason)
+}
+
+// simulate executes the call against the latest state and converts a revert
+// into a RevertError carrying the decoded reason.
+func (b *TxBuild) simulate(ctx context.Context, msg ethereum.CallMsg) error {
+	if _, err := b.client.CallContract(ctx, msg, nil); err != nil {
+		if revertErr := asRevertError(err); revertErr != nil {
+			return revertErr
+		}
+		return err
+	}
+	return nil
+}
+
+// estimateGas estimates the gas of a call making the given number of
+// transfers, applies the safety multiplier and caps the result at the gas cap
+// of a transfer times transfers. It falls back to the static ERC20 transfer
+// limits when the node cannot estimate a single transfer, a batch has no such
+// fallback.
+func (b *TxBuild) estimateGas(ctx context.Context, msg ethereum.CallMsg, transfers int) (uint64, error) {
+	estimated, err := b.client.EstimateGas(ctx, msg)
+	if err != nil {
+		if revertErr := asRevertError(err); revertErr != nil {
+			return 0, revertErr
+		}
+		if transfers > 1 {
+			return 0, fmt.Errorf("failed to estimate gas of a batch: %w", err)
+		}
+		log.WithError(err).Warn("failed to estimate gas, falling back to static gas limit")
+		return b.staticGasLimit(ctx, *msg.To, msg.Data), nil
+	}
+
+	multiplier := b.gasMultiplier
+	if multiplier < 1 {
+		multiplier = defaultGasMultiplier
+	}
+	gasLimit := uint64(math.Ceil(float64(estimated) * multiplier))
+	gasCap := b.gasCap
+	if gasCap == 0 {
+		gasCap = defaultGasCap
+	}
+	if transfers > 1 {
+		gasCap *= uint64(transfers)
+	}
+	if gasLimit > gasCap {
+		if estimated > gasCap {
+			return 0, fmt.Errorf("estimated gas %d exceeds the configured gas cap %d", estimated, gasCap)
+		}
+		gasLimit = gasCap
+	}
+
+	return gasLimit, nil
+}
+
+// staticGasLimit picks the hard-coded limit of an ERC20 transfer, which costs
+// more when the recipient does not hold any tokens yet.
+func (b *TxBuild) staticGasLimit(ctx context.Context, tokenAddress common.Address, data []byte) uint64 {
+	recipient, ok := transferRecipient(data)
+	if !ok {
+		return gasLimitNonInitializedAccount
+	}
+	token, err := bindings.NewTokenCaller(tokenAddress, b.client)
+	if err != nil {
+		return gasLimitNonInitializedAccount
+	}
+	balance, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, recipient)
+	if err != nil || balance.BitLen() == 0 {
+		return gasLimitNonInitializedAccount
+	}
+	return gasLimitInitializedAccount
+}
+
+// transferRecipient returns the recipient of token calldata, the first
+// argument of a transfer or mint and the second one of a transferFrom.
+func transferRecipient(data []byte) (common.Address, bool) {
+	offset := 4
+	if len(data) >= 4 && bytes.Equal(data[:4], methodID("transferFrom(address,address,uint256)")) {
+		offset += 32
+	}
+	if len(data) < offset+32 {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(data[offset : offset+32]), true
+}
+
+// asRevertError returns a RevertError when err reports a reverted execution,
+// decoding the Error(string) or Panic(uint256) payload when the node returns it.
+func asRevertError(err error) *RevertError {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if raw, decodeErr := hexutil.Decode(data); decodeErr == nil {
+				reason, unpackErr := abi.UnpackRevert(raw)
+				if unpackErr == nil {
+					return &RevertError{Reason: reason}
+				}
+				return &RevertError{}
+			}
+		}
+	}
+	if strings.Contains(err.Error(), "execution reverted") {
+		reason := strings.TrimPrefix(strings.TrimPrefix(err.Error(), "execution reverted"), ": ")
+		return &RevertError{Reason: reason}
+	}
+	return nil
+}
+
+func callMsg(from, to common.Address, value *big.Int, data []byte) ethereum.CallMsg {
+	return ethereum.CallMsg{
+		From:  from,
+		To:    &to,
+		Value: value,
+		Data:  data,
+	}
+}
@@ -0,0 +1,152 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testTokenAddress = common.HexToAddress("0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D")
+	// Returns uint256(1) for every call: PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+	mockTokenCode = hexutil.MustDecode("0x600160005260206000f3")
+	// Copies the ABI encoded Error("nope") behind the code into memory and reverts with it
+	revertingTokenCode = hexutil.MustDecode("0x6064600c60003960646000fd" +
+		"08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000")
+)
+
+type noEstimateClient struct {
+	simulated.Client
+}
+
+func (c *noEstimateClient) EstimateGas(_ context.Context, _ ethereum.CallMsg) (uint64, error) {
+	return 0, errors.New("method not available")
+}
+
+func newTestTokenBuilder(t *testing.T, tokenCode []byte) (*TxBuild, *simulated.Backend) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simBackend := simulated.NewBackend(
+		types.GenesisAlloc{
+			fromAddress:      {Balance: big.NewInt(10000000000000000)},
+			testTokenAddress: {Code: tokenCode, Balance: big.NewInt(0)},
+		})
+	t.Cleanup(func() { simBackend.Close() })
+
+	return &TxBuild{
+		client:  simBackend.Client(),
+		wallets: []*wallet{newWallet(simBackend.Client(), privateKey)},
+		signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+		chainID: big.NewInt(1337),
+	}, simBackend
+}
+
+func TestTxBuilder_EstimateGas(t *testing.T) {
+	testcases := []struct {
+		name       string
+		multiplier float64
+		gasCap     uint64
+		wantErr    bool
+	}{
+		{name: "should apply the default multiplier"},
+		{name: "should apply the configured multiplier", multiplier: 1.5},
+		{name: "should cap the gas limit", multiplier: 3, gasCap: 30000},
+		{name: "should refuse transfers estimated above the cap", gasCap: 21000, wantErr: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+			txBuilder.gasMultiplier = tc.multiplier
+			txBuilder.gasCap = tc.gasCap
+			bgCtx := context.Background()
+			toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+			txHash, err := txBuilder.TransferERC20(bgCtx, testTokenAddress, toAddress.Hex(), big.NewInt(1000))
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			simBackend.Commit()
+
+			tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+			require.NoError(t, err)
+			estimated, err := simBackend.Client().EstimateGas(bgCtx, callMsg(txBuilder.Sender(), *tx.To(), nil, tx.Data()))
+			require.NoError(t, err)
+
+			multiplier := tc.multiplier
+			if multiplier == 0 {
+				multiplier = defaultGasMultiplier
+			}
+			want := uint64(math.Ceil(float64(estimated) * multiplier))
+			if tc.gasCap != 0 && want > tc.gasCap {
+				want = tc.gasCap
+			}
+			assert.Equal(t, want, tx.Gas())
+		})
+	}
+}
+
+func TestTxBuilder_SimulateRevert(t *testing.T) {
+	txBuilder, _ := newTestTokenBuilder(t, revertingTokenCode)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	_, err := txBuilder.TransferERC20(bgCtx, testTokenAddress, toAddress.Hex(), big.NewInt(1000))
+	var revertErr *RevertError
+	require.ErrorAs(t, err, &revertErr)
+	assert.Equal(t, "nope", revertErr.Reason)
+
+	pending, err := txBuilder.client.PendingNonceAt(bgCtx, txBuilder.Sender())
+	require.NoError(t, err)
+	assert.Zero(t, pending, "reverting transfer must not be broadcast")
+}
+
+func TestTransferRecipient(t *testing.T) {
+	owner := common.HexToAddress("0x71562b71999873DB5b286dF957af199Ec94617F7")
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	value := addLeftPadding(big.NewInt(1000).Bytes())
+	calldata := func(signature string, args ...[]byte) []byte {
+		data := methodID(signature)
+		for _, arg := range args {
+			data = append(data, arg...)
+		}
+		return data
+	}
+
+	testcases := []struct {
+		name   string
+		data   []byte
+		wantOk bool
+	}{
+		{name: "transfer", data: calldata("transfer(address,uint256)", addLeftPadding(recipient.Bytes()), value), wantOk: true},
+		{name: "transferFrom", data: calldata("transferFrom(address,address,uint256)", addLeftPadding(owner.Bytes()), addLeftPadding(recipient.Bytes()), value), wantOk: true},
+		{name: "mint", data: calldata("mint(address,uint256)", addLeftPadding(recipient.Bytes()), value), wantOk: true},
+		{name: "truncated transferFrom", data: calldata("transferFrom(address,address,uint256)", addLeftPadding(owner.Bytes()))},
+		{name: "no calldata"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := transferRecipient(tc.data)
+			require.Equal(t, tc.wantOk, ok)
+			if ok {
+				assert.Equal(t, recipient, got)
+			}
+		})
+	}
+}
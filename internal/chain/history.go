@@ -0,0 +1,135 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
+)
+
+// Nodes limit the block range of a single log query, so longer ranges are
+// queried in chunks.
+const logQueryChunk uint64 = 5000
+
+// Transfer is a token transfer sent or minted by the faucet account.
+type Transfer struct {
+	From        common.Address
+	To          common.Address
+	TxHash      common.Hash
+	BlockNumber uint64
+	Time        time.Time
+}
+
+// BlockNumber returns the number of the latest block.
+func (b *TxBuild) BlockNumber(ctx context.Context) (uint64, error) {
+	header, err := b.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return header.Number.Uint64(), nil
+}
+
+// SentTransfers returns the Transfer events of token sent by the funding
+// accounts or the relays between fromBlock and toBlock inclusive, in block
+// order. Relays are contracts paying out on behalf of the funding accounts,
+// such as the disperse contract. Relays pay out for anyone, so their
+// transfers are only kept when a funding account sent the transaction.
+func (b *TxBuild) SentTransfers(ctx context.Context, token common.Address, fromBlock, toBlock uint64, relays ...common.Address) ([]Transfer, error) {
+	senders := make([]common.Address, 0, len(b.wallets)+len(relays))
+	for _, w := range b.wallets {
+		senders = append(senders, w.address)
+	}
+	senders = append(senders, relays...)
+	transfers, err := b.transfers(ctx, token, senders, fromBlock, toBlock)
+	if err != nil || len(relays) == 0 {
+		return transfers, err
+	}
+
+	sentByWallet := make(map[common.Hash]bool)
+	sent := transfers[:0]
+	for _, transfer := range transfers {
+		if _, ok := b.wallet(transfer.From); !ok {
+			ours, checked := sentByWallet[transfer.TxHash]
+			if !checked {
+				if ours, err = b.sentByWallet(ctx, transfer.TxHash); err != nil {
+					return nil, err
+				}
+				sentByWallet[transfer.TxHash] = ours
+			}
+			if !ours {
+				continue
+			}
+		}
+		sent = append(sent, transfer)
+	}
+	return sent, nil
+}
+
+// sentByWallet reports whether a funding account sent the transaction hash.
+func (b *TxBuild) sentByWallet(ctx context.Context, hash common.Hash) (bool, error) {
+	tx, _, err := b.client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+	from, err := types.Sender(b.signer, tx)
+	if err != nil {
+		return false, err
+	}
+	_, ok := b.wallet(from)
+	return ok, nil
+}
+
+// MintedTransfers returns the Transfer events of token minted between
+// fromBlock and toBlock inclusive, in block order. Events do not tell the
+// minter apart, so mints by other minters are included.
+func (b *TxBuild) MintedTransfers(ctx context.Context, token common.Address, fromBlock, toBlock uint64) ([]Transfer, error) {
+	return b.transfers(ctx, token, []common.Address{{}}, fromBlock, toBlock)
+}
+
+func (b *TxBuild) transfers(ctx context.Context, token common.Address, from []common.Address, fromBlock, toBlock uint64) ([]Transfer, error) {
+	filterer, err := bindings.NewTokenFilterer(token, b.client)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []Transfer
+	blockTimes := make(map[uint64]time.Time)
+	for start := fromBlock; start <= toBlock; start += logQueryChunk {
+		end := min(start+logQueryChunk-1, toBlock)
+		iter, err := filterer.FilterTransfer(&bind.FilterOpts{Start: start, End: &end, Context: ctx}, from, nil)
+		if err != nil {
+			return nil, err
+		}
+		for iter.Next() {
+			event := iter.Event
+			blockTime, ok := blockTimes[event.Raw.BlockNumber]
+			if !ok {
+				header, err := b.client.HeaderByNumber(ctx, new(big.Int).SetUint64(event.Raw.BlockNumber))
+				if err != nil {
+					iter.Close()
+					return nil, err
+				}
+				blockTime = time.Unix(int64(header.Time), 0)
+				blockTimes[event.Raw.BlockNumber] = blockTime
+			}
+			transfers = append(transfers, Transfer{
+				From:        event.From,
+				To:          event.To,
+				TxHash:      event.Raw.TxHash,
+				BlockNumber: event.Raw.BlockNumber,
+				Time:        blockTime,
+			})
+		}
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transfers, nil
+}
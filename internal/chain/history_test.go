@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Emits Transfer(caller, to, value) with the arguments of transfer(to, value)
+// and returns true
+var transferEventTokenCode = hexutil.MustDecode("0x602435600052600435337f" +
+	"ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" +
+	"60206000a3600160005260206000f3")
+
+func TestTxBuilder_SentTransfers(t *testing.T) {
+	txBuilder, simBackend := newTestTokenBuilder(t, transferEventTokenCode)
+	bgCtx := context.Background()
+	recipients := []common.Address{
+		common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"),
+		common.HexToAddress("0x0000000000000000000000000000000000000bEE"),
+	}
+
+	var hashes []common.Hash
+	for _, recipient := range recipients {
+		txHash, err := txBuilder.TransferERC20(bgCtx, testTokenAddress, recipient.Hex(), big.NewInt(1000))
+		require.NoError(t, err)
+		hashes = append(hashes, txHash)
+		simBackend.Commit()
+	}
+
+	head, err := txBuilder.BlockNumber(bgCtx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), head)
+
+	transfers, err := txBuilder.SentTransfers(bgCtx, testTokenAddress, 0, head)
+	require.NoError(t, err)
+	require.Len(t, transfers, 2)
+	for i, transfer := range transfers {
+		assert.Equal(t, recipients[i], transfer.To)
+		assert.Equal(t, hashes[i], transfer.TxHash)
+		assert.Equal(t, uint64(i+1), transfer.BlockNumber)
+		assert.False(t, transfer.Time.IsZero())
+	}
+
+	transfers, err = txBuilder.SentTransfers(bgCtx, testTokenAddress, 2, head)
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	assert.Equal(t, recipients[1], transfers[0].To)
+}
+
+// relayCode forwards its calldata to token, like a disperse contract paying
+// out through it for whoever calls it.
+func relayCode(token common.Address) []byte {
+	runtime := append(hexutil.MustDecode("0x36600060003760206000366000600073"), token.Bytes()...)
+	runtime = append(runtime, hexutil.MustDecode("0x5af15060206000f3")...)
+	return append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, runtime...)
+}
+
+func TestTxBuilder_SentTransfersOfRelays(t *testing.T) {
+	txBuilder, simBackend := newTestTokenBuilder(t, transferEventTokenCode)
+	bgCtx := context.Background()
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	stranger := common.HexToAddress("0x0000000000000000000000000000000000000bEE")
+
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	other := crypto.PubkeyToAddress(otherKey.PublicKey)
+	_, err = txBuilder.TransferETH(bgCtx, other.Hex(), big.NewInt(1000000000000000))
+	require.NoError(t, err)
+	simBackend.Commit()
+	opts, err := bind.NewKeyedTransactorWithChainID(otherKey, txBuilder.chainID)
+	require.NoError(t, err)
+	relay, _, _, err := bind.DeployContract(opts, abi.ABI{}, relayCode(testTokenAddress), simBackend.Client())
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	// The token reports the relay as the sender of both transfers
+	txHash, err := txBuilder.TransferERC20(bgCtx, relay, recipient.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	otherBuilder := &TxBuild{
+		client:  simBackend.Client(),
+		wallets: []*wallet{newWallet(simBackend.Client(), otherKey)},
+		signer:  txBuilder.signer,
+		chainID: txBuilder.chainID,
+	}
+	_, err = otherBuilder.TransferERC20(bgCtx, relay, stranger.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	head, err := txBuilder.BlockNumber(bgCtx)
+	require.NoError(t, err)
+	transfers, err := txBuilder.SentTransfers(bgCtx, testTokenAddress, 0, head)
+	require.NoError(t, err)
+	assert.Empty(t, transfers)
+
+	// Only the transfer relayed in a transaction of the funding account is kept
+	transfers, err = txBuilder.SentTransfers(bgCtx, testTokenAddress, 0, head, relay)
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	assert.Equal(t, relay, transfers[0].From)
+	assert.Equal(t, recipient, transfers[0].To)
+	assert.Equal(t, txHash, transfers[0].TxHash)
+}
@@ -25,24 +25,38 @@ func DecryptKeyfile(keyfile, password string) (*ecdsa.PrivateKey, error) {
 }
 
 func ResolveKeyfilePath(keydir string) (string, error) {
+	keyfiles, err := ResolveKeyfilePaths(keydir)
+	if err != nil {
+		return "", err
+	}
+	return keyfiles[0], nil
+}
+
+// ResolveKeyfilePaths returns keydir when it is a file, or every UTC-- keyfile
+// in the keydir directory sorted by name.
+func ResolveKeyfilePaths(keydir string) ([]string, error) {
 	keydir, _ = filepath.Abs(keydir)
 	fileInfo, err := os.Stat(keydir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if !fileInfo.IsDir() {
-		return keydir, nil
+		return []string{keydir}, nil
 	}
 
+	var keyfiles []string
 	files, _ := os.ReadDir(keydir)
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
 		if strings.HasPrefix(file.Name(), "UTC--") {
-			return filepath.Join(keydir, file.Name()), nil
+			keyfiles = append(keyfiles, filepath.Join(keydir, file.Name()))
 		}
 	}
+	if len(keyfiles) == 0 {
+		return nil, fmt.Errorf("keyfile is not in %s", keydir)
+	}
 
-	return "", fmt.Errorf("keyfile is not in %s", keydir)
+	return keyfiles, nil
 }
@@ -90,3 +90,29 @@ func TestResolveKeyfilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveKeyfilePaths(t *testing.T) {
+	got, err := ResolveKeyfilePaths("testdata/keystore")
+	if err != nil {
+		t.Fatalf("ResolveKeyfilePaths() error = %v", err)
+	}
+	want := []string{
+		"UTC--2016-03-22T12-57-55.920751759Z--7ef5a6135f1fd6a02593eedc869c6d41d934aef8",
+		"UTC--2024-05-14T09-12-31.284516391Z--71562b71999873db5b286df957af199ec94617f7",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ResolveKeyfilePaths() got = %v, want %v", got, want)
+	}
+	for i := range got {
+		if filepath.Base(got[i]) != want[i] {
+			t.Errorf("ResolveKeyfilePaths() got = %v, want %v", filepath.Base(got[i]), want[i])
+		}
+		if _, err := DecryptKeyfile(got[i], "foobar"); err != nil {
+			t.Errorf("DecryptKeyfile(%s) error = %v", got[i], err)
+		}
+	}
+
+	if _, err := ResolveKeyfilePaths("testdata/keystore/null"); err == nil {
+		t.Errorf("ResolveKeyfilePaths() expected error for missing directory")
+	}
+}
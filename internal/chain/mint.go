@@ -0,0 +1,48 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/LiskHQ/lsk-faucet/internal/bindings"
+)
+
+// MintERC20 mints value of token to the recipient, for tokens the faucet
+// account is allowed to mint.
+func (b *TxBuild) MintERC20(ctx context.Context, tokenAddress common.Address, to string, value *big.Int) (common.Hash, error) {
+	return b.sendFromPool(ctx, b.candidates(), tokenAddress, nil, mintData(common.HexToAddress(to), value))
+}
+
+// CheckMinter verifies that the faucet account may mint token. The faucet
+// account is the minter of an OptimismMintableERC20 token when it is the
+// token's bridge, any other token must accept a dry run of a mint. Only the
+// primary account is checked, mints fall back to it when another funding
+// account may not mint.
+func (b *TxBuild) CheckMinter(ctx context.Context, tokenAddress common.Address) error {
+	caller, err := bindings.NewTokenCaller(tokenAddress, b.client)
+	if err != nil {
+		return err
+	}
+	sender := b.Sender()
+	if bridge, err := caller.BRIDGE(&bind.CallOpts{Context: ctx}); err == nil && bridge == sender {
+		return nil
+	}
+
+	msg := callMsg(sender, tokenAddress, nil, mintData(sender, big.NewInt(1)))
+	if err := b.simulate(ctx, msg); err != nil {
+		return fmt.Errorf("faucet account %s is not allowed to mint %s: %w", sender.Hex(), tokenAddress.Hex(), err)
+	}
+	return nil
+}
+
+func mintData(to common.Address, value *big.Int) []byte {
+	var data []byte
+	data = append(data, methodID("mint(address,uint256)")...)
+	data = append(data, addLeftPadding(to.Bytes())...)
+	data = append(data, addLeftPadding(value.Bytes())...)
+	return data
+}
@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxBuilder_MintERC20(t *testing.T) {
+	txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	txHash, err := txBuilder.MintERC20(bgCtx, testTokenAddress, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	data := tx.Data()
+	require.Len(t, data, 4+2*32)
+	assert.Equal(t, hexutil.MustDecode("0x40c10f19"), data[:4])
+	assert.Equal(t, toAddress, common.BytesToAddress(data[4:36]))
+	assert.Equal(t, big.NewInt(1000), new(big.Int).SetBytes(data[36:]))
+}
+
+func TestTxBuilder_CheckMinter(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenCode []byte
+		wantErr   bool
+	}{
+		{name: "dry run passes", tokenCode: mockTokenCode},
+		{name: "dry run reverts", tokenCode: revertingTokenCode, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			txBuilder, _ := newTestTokenBuilder(t, tc.tokenCode)
+			err := txBuilder.CheckMinter(context.Background(), testTokenAddress)
+			if tc.wantErr {
+				var revertErr *RevertError
+				assert.ErrorAs(t, err, &revertErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
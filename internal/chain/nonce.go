@@ -0,0 +1,102 @@
+package chain
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+type pendingNonceReader interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// nonceManager hands out nonces for a single account. Signing and broadcasting
+// happen while the manager is locked so nonces reach the node in order and a
+// failed broadcast never leaves a gap behind it.
+type nonceManager struct {
+	mutex   sync.Mutex
+	client  pendingNonceReader
+	account common.Address
+	nonce   uint64
+	synced  bool
+}
+
+func newNonceManager(client pendingNonceReader, account common.Address) *nonceManager {
+	return &nonceManager{
+		client:  client,
+		account: account,
+	}
+}
+
+// send calls fn with the next nonce of the account and consumes the nonce only
+// when fn succeeds. A nonce related failure resyncs with the node and retries
+// once, other failures force a resync before the next nonce is handed out.
+func (m *nonceManager) send(ctx context.Context, fn func(nonce uint64) error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.syncIfNeeded(ctx); err != nil {
+		return err
+	}
+
+	err := fn(m.nonce)
+	if err != nil && isNonceError(err) {
+		log.WithError(err).WithField("nonce", m.nonce).Warn("nonce rejected by node, resyncing")
+		m.synced = false
+		if err := m.syncIfNeeded(ctx); err != nil {
+			return err
+		}
+		err = fn(m.nonce)
+	}
+	if err != nil {
+		m.synced = false
+		return err
+	}
+
+	m.nonce++
+	return nil
+}
+
+// resync makes the next send ask the node for the nonce again, for example
+// after a transaction of the account was dropped and left a gap behind it.
+func (m *nonceManager) resync() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.synced = false
+}
+
+func (m *nonceManager) syncIfNeeded(ctx context.Context) error {
+	if m.synced {
+		return nil
+	}
+
+	nonce, err := m.client.PendingNonceAt(ctx, m.account)
+	if err != nil {
+		log.WithError(err).WithField("address", m.account).Error("failed to refresh nonce")
+		return err
+	}
+	if nonce != m.nonce {
+		log.WithFields(log.Fields{
+			"address": m.account,
+			"local":   m.nonce,
+			"remote":  nonce,
+		}).Info("nonce resynced with node")
+	}
+
+	m.nonce = nonce
+	m.synced = true
+	return nil
+}
+
+func isNonceError(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce")
+}
+
+// isAlreadyKnown reports whether a node refused a transaction because the
+// very same signed transaction is already in its pool, so it was broadcast.
+func isAlreadyKnown(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "already known")
+}
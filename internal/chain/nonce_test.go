@@ -0,0 +1,216 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyClient struct {
+	simulated.Client
+	failures atomic.Int32
+}
+
+func (c *flakyClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.failures.Add(-1) >= 0 {
+		return errors.New("connection reset by peer")
+	}
+	return c.Client.SendTransaction(ctx, tx)
+}
+
+// relayedClient broadcasts transactions, but reports them as already known
+// like a node that received them through another peer first.
+type relayedClient struct {
+	simulated.Client
+}
+
+func (c *relayedClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := c.Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	return errors.New("already known")
+}
+
+// lossyClient reports the next transactions as sent without broadcasting
+// them, like a node that accepts transactions and then loses them.
+type lossyClient struct {
+	simulated.Client
+	losses atomic.Int32
+}
+
+func (c *lossyClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.losses.Add(-1) >= 0 {
+		return nil
+	}
+	return c.Client.SendTransaction(ctx, tx)
+}
+
+func newTestTxBuilder(t *testing.T) (*TxBuild, *simulated.Backend) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	balance, _ := new(big.Int).SetString("100000000000000000000", 10)
+	simBackend := simulated.NewBackend(
+		types.GenesisAlloc{
+			fromAddress: {Balance: balance},
+		})
+	t.Cleanup(func() { simBackend.Close() })
+
+	return &TxBuild{
+		client:  simBackend.Client(),
+		wallets: []*wallet{newWallet(simBackend.Client(), privateKey)},
+		signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+		chainID: big.NewInt(1337),
+	}, simBackend
+}
+
+func TestNonceManager_ConcurrentClaims(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	tokenAddress := common.HexToAddress("0xbb5801a7D398351b8bE11C439e05C5B3259aeux0")
+
+	const claims = 300
+	var wg sync.WaitGroup
+	hashes := make([]common.Hash, claims)
+	errs := make([]error, claims)
+	for i := 0; i < claims; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				hashes[i], errs[i] = txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+			} else {
+				hashes[i], errs[i] = txBuilder.TransferERC20(bgCtx, tokenAddress, toAddress.Hex(), big.NewInt(1))
+			}
+		}(i)
+	}
+	wg.Wait()
+	simBackend.Commit()
+
+	nonces := make(map[uint64]bool, claims)
+	for i, txHash := range hashes {
+		require.NoError(t, errs[i])
+		tx, pending, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+		require.NoError(t, err)
+		assert.False(t, pending)
+		assert.False(t, nonces[tx.Nonce()], "nonce %d used twice", tx.Nonce())
+		nonces[tx.Nonce()] = true
+	}
+	for nonce := uint64(0); nonce < claims; nonce++ {
+		assert.True(t, nonces[nonce], "nonce %d was skipped", nonce)
+	}
+}
+
+func TestNonceManager_ResyncAfterExternalTx(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	_, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+
+	// Another process spends the next nonce of the faucet account
+	gasPrice, _ := simBackend.Client().SuggestGasPrice(bgCtx)
+	externalTx, _ := types.SignTx(types.NewTransaction(1, toAddress, big.NewInt(1), 21000, gasPrice, nil), txBuilder.signer, txBuilder.wallets[0].privateKey)
+	require.NoError(t, simBackend.Client().SendTransaction(bgCtx, externalTx))
+	simBackend.Commit()
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), tx.Nonce())
+}
+
+func TestNonceManager_NoGapAfterFailedBroadcast(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	client := &flakyClient{Client: simBackend.Client()}
+	txBuilder.client = client
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	_, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+
+	client.failures.Store(1)
+	_, err = txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.Error(t, err)
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, pending, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, uint64(1), tx.Nonce())
+}
+
+func TestNonceManager_AlreadyKnownIsSent(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	txBuilder.client = &relayedClient{Client: simBackend.Client()}
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	first, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	second, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	// Both transfers went out once, at consecutive nonces
+	for nonce, txHash := range []common.Hash{first, second} {
+		tx, pending, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+		require.NoError(t, err)
+		assert.False(t, pending)
+		assert.Equal(t, uint64(nonce), tx.Nonce())
+	}
+	balance, err := simBackend.Client().BalanceAt(bgCtx, toAddress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(2), balance)
+}
+
+func TestNonceManager_DroppedTxFreesNonce(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	client := &lossyClient{Client: simBackend.Client()}
+	txBuilder.client = client
+	txBuilder.watcher = NewReceiptWatcher(simBackend.Client(), 1)
+	txBuilder.watcher.dropTimeout = 0
+	txBuilder.watcher.onDropped = txBuilder.dropped
+	bgCtx := context.Background()
+	simBackend.Commit()
+	waitForIndexing(t, txBuilder.watcher, common.Hash{})
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	client.losses.Store(1)
+	lost, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	txBuilder.watcher.poll(bgCtx)
+	time.Sleep(time.Millisecond)
+	txBuilder.watcher.poll(bgCtx)
+	state, ok := txBuilder.TransactionState(lost)
+	require.True(t, ok)
+	require.Equal(t, TxFailed, state.Status)
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, pending, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.False(t, pending)
+	assert.Equal(t, uint64(0), tx.Nonce())
+}
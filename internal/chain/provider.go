@@ -0,0 +1,437 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	providerProbeInterval = 15 * time.Second
+	providerProbeTimeout  = 5 * time.Second
+	// An endpoint more blocks behind the highest known head serves stale state
+	providerMaxBlockLag = 10
+	// An endpoint is down after that many failed requests in a row
+	providerMaxFailures = 3
+	// Weight of the latest sample in the latency and error rate averages
+	providerEWMAWeight = 0.2
+)
+
+// nodeClient is the node API of a single RPC endpoint.
+type nodeClient interface {
+	backend
+	receiptBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+}
+
+var errNoProvider = errors.New("no RPC provider serves the expected chain")
+
+// ProviderStatus is the health of an RPC endpoint as observed by the pool.
+// ChainID is nil until the endpoint reported it, WrongChain is set while it
+// serves another chain than the pool.
+type ProviderStatus struct {
+	URL         string
+	Healthy     bool
+	ChainID     *big.Int
+	WrongChain  bool
+	BlockNumber uint64
+	Latency     time.Duration
+	ErrorRate   float64
+	Requests    uint64
+	Failures    uint64
+	LastError   string
+	CheckedAt   time.Time
+}
+
+type provider struct {
+	url       string
+	client    nodeClient
+	chainID   *big.Int
+	wrong     bool
+	latency   time.Duration
+	errorRate float64
+	head      uint64
+	requests  uint64
+	failures  uint64
+	failing   int
+	lastError string
+	checkedAt time.Time
+}
+
+// ProviderPool routes node requests to the healthiest of several RPC
+// endpoints and fails over to the next one when an endpoint cannot be
+// reached. Endpoints are scored by their latency and error rate, and those
+// that fail repeatedly or lag behind the highest block are only used when no
+// other endpoint is left. Endpoints serving another chain than the verified
+// one are never used. Errors returned by a node, such as reverts or
+// rejected transactions, are passed on without failing over.
+type ProviderPool struct {
+	mutex     sync.RWMutex
+	providers []*provider
+	chainID   *big.Int
+}
+
+// DialProviders connects to every RPC endpoint of urls.
+func DialProviders(urls []string) (*ProviderPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no RPC provider configured")
+	}
+	clients := make([]nodeClient, len(urls))
+	for i, rawURL := range urls {
+		client, err := ethclient.Dial(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = client
+	}
+	return newProviderPool(urls, clients), nil
+}
+
+func newProviderPool(urls []string, clients []nodeClient) *ProviderPool {
+	pool := &ProviderPool{}
+	for i, client := range clients {
+		pool.providers = append(pool.providers, &provider{url: urls[i], client: client})
+	}
+	return pool
+}
+
+// VerifyChainID checks that every reachable endpoint serves the expected
+// chain, or the chain of the first reachable endpoint when expected is nil,
+// and returns the verified chain ID. It fails when no endpoint can be reached,
+// as the chain was never checked. Endpoints that cannot be reached yet stay
+// out of rotation until Run verified their chain.
+func (p *ProviderPool) VerifyChainID(ctx context.Context, expected *big.Int) (*big.Int, error) {
+	verified := 0
+	for _, pr := range p.providers {
+		chainID, err := pr.client.ChainID(ctx)
+		if err != nil {
+			log.WithError(err).WithField("provider", redactURL(pr.url)).Warn("failed to read chain ID of RPC provider")
+			continue
+		}
+		if expected == nil {
+			expected = chainID
+		}
+		if chainID.Cmp(expected) != 0 {
+			return nil, fmt.Errorf("RPC provider %s serves chain %s, expected chain %s", redactURL(pr.url), chainID, expected)
+		}
+		p.mutex.Lock()
+		pr.chainID = chainID
+		p.mutex.Unlock()
+		verified++
+	}
+	if verified == 0 {
+		return nil, errors.New("no RPC provider reachable to verify the chain ID")
+	}
+	if verified < len(p.providers) {
+		log.WithFields(log.Fields{
+			"verified":  verified,
+			"providers": len(p.providers),
+		}).Warn("some RPC providers are out of rotation until their chain ID is verified")
+	}
+
+	p.mutex.Lock()
+	p.chainID = expected
+	p.mutex.Unlock()
+	return expected, nil
+}
+
+// Run probes the block height and chain ID of every endpoint until the
+// context is canceled, so idle endpoints are scored as well and an endpoint
+// that starts serving another chain is taken out of rotation.
+func (p *ProviderPool) Run(ctx context.Context) {
+	p.probe(ctx)
+	ticker := time.NewTicker(providerProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.probe(ctx)
+		}
+	}
+}
+
+func (p *ProviderPool) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, pr := range p.providers {
+		wg.Add(1)
+		go func(pr *provider) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, providerProbeTimeout)
+			defer cancel()
+			p.checkChainID(probeCtx, pr)
+			start := time.Now()
+			head, err := pr.client.BlockNumber(probeCtx)
+			p.record(pr, time.Since(start), err)
+			if err == nil {
+				p.mutex.Lock()
+				pr.head = head
+				pr.checkedAt = time.Now()
+				p.mutex.Unlock()
+			}
+		}(pr)
+	}
+	wg.Wait()
+}
+
+func (p *ProviderPool) checkChainID(ctx context.Context, pr *provider) {
+	p.mutex.RLock()
+	expected := p.chainID
+	p.mutex.RUnlock()
+	if expected == nil {
+		return
+	}
+	chainID, err := pr.client.ChainID(ctx)
+	if err != nil {
+		// The block height probe records the failure
+		return
+	}
+
+	wrong := chainID.Cmp(expected) != 0
+	p.mutex.Lock()
+	changed := wrong != pr.wrong
+	pr.chainID, pr.wrong = chainID, wrong
+	p.mutex.Unlock()
+	switch {
+	case changed && wrong:
+		log.WithFields(log.Fields{
+			"provider": redactURL(pr.url),
+			"chainID":  chainID,
+			"expected": expected,
+		}).Error("RPC provider serves another chain, taking it out of rotation")
+	case changed:
+		log.WithField("provider", redactURL(pr.url)).Info("RPC provider serves the expected chain again")
+	}
+}
+
+// Status returns the health of every endpoint in the configured order.
+func (p *ProviderPool) Status() []ProviderStatus {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	best := p.bestHead()
+	statuses := make([]ProviderStatus, len(p.providers))
+	for i, pr := range p.providers {
+		statuses[i] = ProviderStatus{
+			URL:         redactURL(pr.url),
+			Healthy:     p.serves(pr) && pr.healthy(best),
+			ChainID:     pr.chainID,
+			WrongChain:  pr.wrong,
+			BlockNumber: pr.head,
+			Latency:     pr.latency,
+			ErrorRate:   pr.errorRate,
+			Requests:    pr.requests,
+			Failures:    pr.failures,
+			LastError:   pr.lastError,
+			CheckedAt:   pr.checkedAt,
+		}
+	}
+	return statuses
+}
+
+func (p *ProviderPool) bestHead() uint64 {
+	var best uint64
+	for _, pr := range p.providers {
+		if !pr.wrong {
+			best = max(best, pr.head)
+		}
+	}
+	return best
+}
+
+// serves reports whether pr is known to serve the verified chain. Before the
+// chain is verified every endpoint is used.
+func (p *ProviderPool) serves(pr *provider) bool {
+	return p.chainID == nil || (pr.chainID != nil && !pr.wrong)
+}
+
+func (pr *provider) healthy(best uint64) bool {
+	return !pr.wrong && pr.failing < providerMaxFailures && pr.head+providerMaxBlockLag >= best
+}
+
+// score ranks healthy endpoints, lower is better. Latency is penalized by the
+// error rate so an endpoint that fails intermittently loses to a slower one.
+func (pr *provider) score() float64 {
+	return float64(pr.latency) * (1 + 10*pr.errorRate)
+}
+
+// ordered returns the endpoints serving the expected chain from the healthiest
+// to the least healthy. Endpoints with the same score keep the configured
+// order.
+func (p *ProviderPool) ordered() []*provider {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	best := p.bestHead()
+	ordered := make([]*provider, 0, len(p.providers))
+	for _, pr := range p.providers {
+		if p.serves(pr) {
+			ordered = append(ordered, pr)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		hi, hj := ordered[i].healthy(best), ordered[j].healthy(best)
+		if hi != hj {
+			return hi
+		}
+		return ordered[i].score() < ordered[j].score()
+	})
+	return ordered
+}
+
+func (p *ProviderPool) record(pr *provider, latency time.Duration, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	failed := isProviderFailure(err)
+	pr.requests++
+	sample := 0.0
+	if failed {
+		sample = 1
+		pr.failures++
+		pr.failing++
+		pr.lastError = err.Error()
+	} else {
+		pr.failing = 0
+		if pr.latency == 0 {
+			pr.latency = latency
+		} else {
+			pr.latency = time.Duration(providerEWMAWeight*float64(latency) + (1-providerEWMAWeight)*float64(pr.latency))
+		}
+	}
+	pr.errorRate = providerEWMAWeight*sample + (1-providerEWMAWeight)*pr.errorRate
+}
+
+// isProviderFailure reports whether err means the endpoint could not serve the
+// request, as opposed to an answer of the node such as a revert or a missing
+// transaction.
+func isProviderFailure(err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+// call runs fn against the endpoints in order of health until one serves it.
+func call[T any](ctx context.Context, p *ProviderPool, fn func(client nodeClient) (T, error)) (T, error) {
+	var result T
+	err := errNoProvider
+	providers := p.ordered()
+	for i, pr := range providers {
+		start := time.Now()
+		result, err = fn(pr.client)
+		p.record(pr, time.Since(start), err)
+		if !isProviderFailure(err) || ctx.Err() != nil {
+			return result, err
+		}
+		if i < len(providers)-1 {
+			log.WithError(err).WithField("provider", redactURL(pr.url)).Warn("RPC provider failed, trying the next one")
+		}
+	}
+	return result, err
+}
+
+// redactURL drops the path and credentials of an endpoint URL, which often
+// carry an API key.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (p *ProviderPool) ChainID(ctx context.Context) (*big.Int, error) {
+	return call(ctx, p, func(c nodeClient) (*big.Int, error) { return c.ChainID(ctx) })
+}
+
+func (p *ProviderPool) BlockNumber(ctx context.Context) (uint64, error) {
+	return call(ctx, p, func(c nodeClient) (uint64, error) { return c.BlockNumber(ctx) })
+}
+
+func (p *ProviderPool) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return call(ctx, p, func(c nodeClient) (*big.Int, error) { return c.BalanceAt(ctx, account, blockNumber) })
+}
+
+func (p *ProviderPool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, func(c nodeClient) ([]byte, error) { return c.CodeAt(ctx, contract, blockNumber) })
+}
+
+func (p *ProviderPool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, func(c nodeClient) ([]byte, error) { return c.CallContract(ctx, msg, blockNumber) })
+}
+
+func (p *ProviderPool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return call(ctx, p, func(c nodeClient) (*types.Header, error) { return c.HeaderByNumber(ctx, number) })
+}
+
+func (p *ProviderPool) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return call(ctx, p, func(c nodeClient) ([]byte, error) { return c.PendingCodeAt(ctx, account) })
+}
+
+func (p *ProviderPool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return call(ctx, p, func(c nodeClient) (uint64, error) { return c.PendingNonceAt(ctx, account) })
+}
+
+func (p *ProviderPool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return call(ctx, p, func(c nodeClient) (*big.Int, error) { return c.SuggestGasPrice(ctx) })
+}
+
+func (p *ProviderPool) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return call(ctx, p, func(c nodeClient) (*big.Int, error) { return c.SuggestGasTipCap(ctx) })
+}
+
+func (p *ProviderPool) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return call(ctx, p, func(c nodeClient) (uint64, error) { return c.EstimateGas(ctx, msg) })
+}
+
+// SendTransaction broadcasts tx through the healthiest endpoint. An endpoint
+// that failed may still have relayed the transaction, so a later endpoint
+// that already knows it counts as a successful broadcast.
+func (p *ProviderPool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	attempts := 0
+	_, err := call(ctx, p, func(c nodeClient) (struct{}, error) {
+		attempts++
+		err := c.SendTransaction(ctx, tx)
+		if err != nil && attempts > 1 && isAlreadyKnown(err) {
+			return struct{}{}, nil
+		}
+		return struct{}{}, err
+	})
+	return err
+}
+
+func (p *ProviderPool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return call(ctx, p, func(c nodeClient) ([]types.Log, error) { return c.FilterLogs(ctx, query) })
+}
+
+func (p *ProviderPool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return call(ctx, p, func(c nodeClient) (ethereum.Subscription, error) { return c.SubscribeFilterLogs(ctx, query, ch) })
+}
+
+func (p *ProviderPool) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type result struct {
+		tx        *types.Transaction
+		isPending bool
+	}
+	r, err := call(ctx, p, func(c nodeClient) (result, error) {
+		tx, isPending, err := c.TransactionByHash(ctx, hash)
+		return result{tx, isPending}, err
+	})
+	return r.tx, r.isPending, err
+}
+
+func (p *ProviderPool) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	return call(ctx, p, func(c nodeClient) (*types.Receipt, error) { return c.TransactionReceipt(ctx, hash) })
+}
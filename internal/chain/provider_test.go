@@ -0,0 +1,230 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnreachable = errors.New("dial tcp: connection refused")
+
+type nodeError struct{ message string }
+
+func (e *nodeError) Error() string  { return e.message }
+func (e *nodeError) ErrorCode() int { return -32000 }
+
+// fakeNode serves requests from the simulated backend unless it is down, and
+// can report a fixed block height or chain ID or reject transactions.
+type fakeNode struct {
+	simulated.Client
+	down    bool
+	head    uint64
+	chainID *big.Int
+	sendErr error
+	calls   int
+}
+
+func (n *fakeNode) ChainID(ctx context.Context) (*big.Int, error) {
+	if n.down {
+		return nil, errUnreachable
+	}
+	if n.chainID != nil {
+		return n.chainID, nil
+	}
+	return n.Client.ChainID(ctx)
+}
+
+func (n *fakeNode) BlockNumber(ctx context.Context) (uint64, error) {
+	n.calls++
+	if n.down {
+		return 0, errUnreachable
+	}
+	if n.head > 0 {
+		return n.head, nil
+	}
+	return n.Client.BlockNumber(ctx)
+}
+
+func (n *fakeNode) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	n.calls++
+	if n.down {
+		return nil, errUnreachable
+	}
+	return n.Client.BalanceAt(ctx, account, blockNumber)
+}
+
+func (n *fakeNode) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	n.calls++
+	return nil, &nodeError{message: "execution reverted"}
+}
+
+func (n *fakeNode) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	n.calls++
+	if n.down {
+		return errUnreachable
+	}
+	if n.sendErr != nil {
+		return n.sendErr
+	}
+	return n.Client.SendTransaction(ctx, tx)
+}
+
+func newTestProviderPool(t *testing.T, nodes ...*fakeNode) *ProviderPool {
+	simBackend := simulated.NewBackend(types.GenesisAlloc{
+		testTokenAddress: {Balance: big.NewInt(1000)},
+	})
+	t.Cleanup(func() { simBackend.Close() })
+
+	urls := make([]string, len(nodes))
+	clients := make([]nodeClient, len(nodes))
+	for i, node := range nodes {
+		node.Client = simBackend.Client()
+		urls[i] = "https://node.example/v3/secret-api-key"
+		clients[i] = node
+	}
+	return newProviderPool(urls, clients)
+}
+
+func TestProviderPool_Failover(t *testing.T) {
+	down, up := &fakeNode{down: true}, &fakeNode{}
+	pool := newTestProviderPool(t, down, up)
+	bgCtx := context.Background()
+
+	for i := 0; i < providerMaxFailures; i++ {
+		balance, err := pool.BalanceAt(bgCtx, testTokenAddress, nil)
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(1000), balance)
+	}
+	assert.Equal(t, providerMaxFailures, down.calls)
+
+	// The failing endpoint is no longer tried first
+	_, err := pool.BalanceAt(bgCtx, testTokenAddress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, providerMaxFailures, down.calls)
+
+	statuses := pool.Status()
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, errUnreachable.Error(), statuses[0].LastError)
+	assert.True(t, statuses[1].Healthy)
+	assert.Equal(t, "https://node.example", statuses[1].URL)
+}
+
+func TestProviderPool_NodeErrorsDoNotFailOver(t *testing.T) {
+	first, second := &fakeNode{}, &fakeNode{}
+	pool := newTestProviderPool(t, first, second)
+
+	_, err := pool.CallContract(context.Background(), ethereum.CallMsg{To: &testTokenAddress}, nil)
+	var rpcErr *nodeError
+	assert.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, 1, first.calls)
+	assert.Equal(t, 0, second.calls)
+	assert.True(t, pool.Status()[0].Healthy)
+}
+
+func TestProviderPool_LaggingEndpoint(t *testing.T) {
+	lagging, ahead := &fakeNode{head: 1}, &fakeNode{head: 1 + providerMaxBlockLag + 1}
+	pool := newTestProviderPool(t, lagging, ahead)
+
+	pool.probe(context.Background())
+	statuses := pool.Status()
+	assert.False(t, statuses[0].Healthy)
+	assert.True(t, statuses[1].Healthy)
+	assert.Equal(t, ahead, pool.ordered()[0].client)
+}
+
+func TestProviderPool_SendAlreadyKnown(t *testing.T) {
+	down, relayed := &fakeNode{down: true}, &fakeNode{sendErr: errors.New("already known")}
+	pool := newTestProviderPool(t, down, relayed)
+
+	tx := types.NewTransaction(0, testTokenAddress, big.NewInt(1), 21000, big.NewInt(1), nil)
+	assert.NoError(t, pool.SendTransaction(context.Background(), tx))
+
+	// A single endpoint reporting a known transaction is a rejection
+	pool = newTestProviderPool(t, &fakeNode{sendErr: errors.New("already known")})
+	assert.Error(t, pool.SendTransaction(context.Background(), tx))
+}
+
+func TestProviderPool_VerifyChainID(t *testing.T) {
+	bgCtx := context.Background()
+
+	pool := newTestProviderPool(t, &fakeNode{down: true}, &fakeNode{})
+	chainID, err := pool.VerifyChainID(bgCtx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1337), chainID)
+
+	pool = newTestProviderPool(t, &fakeNode{}, &fakeNode{})
+	_, err = pool.VerifyChainID(bgCtx, big.NewInt(4202))
+	assert.ErrorContains(t, err, "serves chain 1337, expected chain 4202")
+
+	pool = newTestProviderPool(t, &fakeNode{}, &fakeNode{chainID: big.NewInt(1)})
+	_, err = pool.VerifyChainID(bgCtx, nil)
+	assert.Error(t, err)
+
+	pool = newTestProviderPool(t, &fakeNode{down: true})
+	_, err = pool.VerifyChainID(bgCtx, nil)
+	assert.Error(t, err)
+
+	// The configured chain is not trusted without an endpoint confirming it
+	pool = newTestProviderPool(t, &fakeNode{down: true}, &fakeNode{down: true})
+	_, err = pool.VerifyChainID(bgCtx, big.NewInt(1337))
+	assert.Error(t, err)
+}
+
+func TestProviderPool_UnverifiedOutOfRotation(t *testing.T) {
+	unreachable, reachable := &fakeNode{down: true}, &fakeNode{}
+	pool := newTestProviderPool(t, unreachable, reachable)
+	bgCtx := context.Background()
+	_, err := pool.VerifyChainID(bgCtx, big.NewInt(1337))
+	require.NoError(t, err)
+
+	// The endpoint comes up, but is only used once the probe read its chain
+	unreachable.down = false
+	_, err = pool.BalanceAt(bgCtx, testTokenAddress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, unreachable.calls)
+	assert.Equal(t, 1, reachable.calls)
+
+	pool.probe(bgCtx)
+	assert.Equal(t, big.NewInt(1337), pool.Status()[0].ChainID)
+	assert.True(t, pool.Status()[0].Healthy)
+}
+
+func TestProviderPool_WrongChainOutOfRotation(t *testing.T) {
+	misrouted, correct := &fakeNode{}, &fakeNode{}
+	pool := newTestProviderPool(t, misrouted, correct)
+	bgCtx := context.Background()
+	_, err := pool.VerifyChainID(bgCtx, nil)
+	require.NoError(t, err)
+
+	// The load balancer starts routing the first endpoint to another network
+	misrouted.chainID = big.NewInt(1)
+	pool.probe(bgCtx)
+	statuses := pool.Status()
+	assert.True(t, statuses[0].WrongChain)
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, big.NewInt(1), statuses[0].ChainID)
+
+	misrouted.calls, correct.calls = 0, 0
+	_, err = pool.BalanceAt(bgCtx, testTokenAddress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, misrouted.calls)
+	assert.Equal(t, 1, correct.calls)
+
+	// Without an endpoint on the verified chain requests fail
+	correct.chainID = big.NewInt(1)
+	pool.probe(bgCtx)
+	_, err = pool.BalanceAt(bgCtx, testTokenAddress, nil)
+	assert.ErrorIs(t, err, errNoProvider)
+
+	misrouted.chainID, correct.chainID = nil, nil
+	pool.probe(bgCtx)
+	assert.False(t, pool.Status()[0].WrongChain)
+}
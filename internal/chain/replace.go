@@ -0,0 +1,141 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Nodes only accept a replacement that raises the fees by at least 10%, bump by
+// 12.5% to stay clear of rounding.
+const (
+	feeBumpNumerator   = 1125
+	feeBumpDenominator = 1000
+)
+
+// StuckTxMonitor re-signs transactions that stay in the mempool longer than
+// the timeout with the same nonce and bumped fees, so a single underpriced
+// claim does not stall every nonce queued behind it.
+type StuckTxMonitor struct {
+	builder   *TxBuild
+	timeout   time.Duration
+	maxFeeCap *big.Int
+}
+
+func NewStuckTxMonitor(builder *TxBuild, timeout time.Duration, maxFeeCap *big.Int) *StuckTxMonitor {
+	return &StuckTxMonitor{
+		builder:   builder,
+		timeout:   timeout,
+		maxFeeCap: maxFeeCap,
+	}
+}
+
+// Run checks for stuck transactions until the context is canceled.
+func (m *StuckTxMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.replaceStuck(ctx)
+		}
+	}
+}
+
+func (m *StuckTxMonitor) replaceStuck(ctx context.Context) {
+	for _, tx := range m.builder.watcher.stuck(m.timeout) {
+		if err := m.replace(ctx, tx); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"txHash": tx.Hash(),
+				"nonce":  tx.Nonce(),
+			}).Warn("failed to replace stuck transaction")
+		}
+	}
+}
+
+func (m *StuckTxMonitor) replace(ctx context.Context, tx *types.Transaction) error {
+	// The replacement ceiling may be above the fee cap of new transactions,
+	// fall back to bumping the stuck fees when the network is above that cap.
+	fees, err := m.builder.suggestFees(ctx)
+	if err != nil {
+		log.WithError(err).Debug("failed to suggest fees for replacement")
+		fees = &txFees{}
+	}
+	bumped, ok := m.bumpFees(tx, fees)
+	if !ok {
+		log.WithFields(log.Fields{
+			"txHash":    tx.Hash(),
+			"maxFeeCap": m.maxFeeCap,
+		}).Warn("stuck transaction already priced at the replacement fee ceiling")
+		return nil
+	}
+
+	from, err := types.Sender(m.builder.signer, tx)
+	if err != nil {
+		return err
+	}
+	w, ok := m.builder.wallet(from)
+	if !ok {
+		return fmt.Errorf("stuck transaction sent by unknown account %s", from.Hex())
+	}
+	replacement := bumped.newTx(m.builder.chainID, tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), tx.Data())
+	signedTx, err := types.SignTx(replacement, m.builder.signer, w.privateKey)
+	if err != nil {
+		return err
+	}
+	if err = m.builder.client.SendTransaction(ctx, signedTx); err != nil {
+		return err
+	}
+
+	m.builder.watcher.Replace(tx.Hash(), signedTx)
+	log.WithFields(log.Fields{
+		"txHash":      tx.Hash(),
+		"replacement": signedTx.Hash(),
+		"nonce":       tx.Nonce(),
+	}).Info("Replaced stuck transaction")
+	return nil
+}
+
+// bumpFees returns the fees for a replacement of tx: the current network fees
+// or the bumped fees of tx, whichever are higher, capped at the ceiling. It
+// reports false when the ceiling does not leave room for a valid replacement.
+func (m *StuckTxMonitor) bumpFees(tx *types.Transaction, current *txFees) (*txFees, bool) {
+	if tx.Type() == types.LegacyTxType {
+		gasPrice := m.capFee(maxBig(bump(tx.GasPrice()), current.gasPrice))
+		return &txFees{gasPrice: gasPrice}, gasPrice.Cmp(bump(tx.GasPrice())) >= 0
+	}
+
+	gasFeeCap := m.capFee(maxBig(bump(tx.GasFeeCap()), current.gasFeeCap))
+	gasTipCap := maxBig(bump(tx.GasTipCap()), current.gasTipCap)
+	if gasTipCap.Cmp(gasFeeCap) > 0 {
+		gasTipCap = gasFeeCap
+	}
+	ok := gasFeeCap.Cmp(bump(tx.GasFeeCap())) >= 0 && gasTipCap.Cmp(bump(tx.GasTipCap())) >= 0
+	return &txFees{gasTipCap: gasTipCap, gasFeeCap: gasFeeCap}, ok
+}
+
+func (m *StuckTxMonitor) capFee(fee *big.Int) *big.Int {
+	if m.maxFeeCap != nil && fee.Cmp(m.maxFeeCap) > 0 {
+		return new(big.Int).Set(m.maxFeeCap)
+	}
+	return fee
+}
+
+func bump(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(feeBumpNumerator))
+	bumped.Div(bumped, big.NewInt(feeBumpDenominator))
+	return bumped.Add(bumped, big.NewInt(1))
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if b != nil && b.Cmp(a) > 0 {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,91 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStuckTxMonitor_ReplaceStuck(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	txBuilder.watcher = NewReceiptWatcher(simBackend.Client(), 1)
+	txBuilder.maxTipCap = big.NewInt(1)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	stuckTx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+
+	// A tip of 1 wei is below the minimum accepted by the miner, the replacement
+	// picks up the suggested network tip once the cap is lifted
+	txBuilder.maxTipCap = nil
+	monitor := NewStuckTxMonitor(txBuilder, 0, nil)
+	monitor.replaceStuck(bgCtx)
+	state, ok := txBuilder.TransactionState(txHash)
+	require.True(t, ok)
+	assert.NotEqual(t, txHash, state.Hash)
+
+	simBackend.Commit()
+	waitForIndexing(t, txBuilder.watcher, state.Hash)
+	state, _ = txBuilder.TransactionState(txHash)
+	assert.Equal(t, TxConfirmed, state.Status)
+	assert.Equal(t, []common.Hash{txHash}, state.Replaced)
+
+	replacement, _, err := simBackend.Client().TransactionByHash(bgCtx, state.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, stuckTx.Nonce(), replacement.Nonce())
+	assert.True(t, replacement.GasTipCap().Cmp(stuckTx.GasTipCap()) > 0)
+	assert.True(t, replacement.GasFeeCap().Cmp(stuckTx.GasFeeCap()) > 0)
+
+	byReplacement, ok := txBuilder.TransactionState(state.Hash)
+	require.True(t, ok)
+	assert.Equal(t, state.Hash, byReplacement.Hash)
+}
+
+func TestStuckTxMonitor_FeeCeiling(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	txBuilder.watcher = NewReceiptWatcher(simBackend.Client(), 1)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	stuckTx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+
+	monitor := NewStuckTxMonitor(txBuilder, 0, stuckTx.GasFeeCap())
+	monitor.replaceStuck(bgCtx)
+
+	state, ok := txBuilder.TransactionState(txHash)
+	require.True(t, ok)
+	assert.Equal(t, txHash, state.Hash)
+	assert.Empty(t, state.Replaced)
+}
+
+func TestStuckTxMonitor_BumpFees(t *testing.T) {
+	monitor := NewStuckTxMonitor(nil, 0, big.NewInt(2000))
+	legacyTx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(1000)})
+
+	fees, ok := monitor.bumpFees(legacyTx, &txFees{gasPrice: big.NewInt(900)})
+	assert.True(t, ok)
+	assert.Equal(t, big.NewInt(1126), fees.gasPrice)
+
+	fees, ok = monitor.bumpFees(legacyTx, &txFees{gasPrice: big.NewInt(1500)})
+	assert.True(t, ok)
+	assert.Equal(t, big.NewInt(1500), fees.gasPrice)
+
+	fees, ok = monitor.bumpFees(legacyTx, &txFees{gasPrice: big.NewInt(5000)})
+	assert.True(t, ok)
+	assert.Equal(t, big.NewInt(2000), fees.gasPrice)
+
+	dynamicTx := types.NewTx(&types.DynamicFeeTx{GasTipCap: big.NewInt(100), GasFeeCap: big.NewInt(1900)})
+	_, ok = monitor.bumpFees(dynamicTx, &txFees{})
+	assert.False(t, ok)
+}
@@ -3,17 +3,15 @@ package chain
 import (
 	"context"
 	"crypto/ecdsa"
-	"fmt"
+	"errors"
 	"math/big"
-	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/LiskHQ/lsk-faucet/internal/bindings"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/sha3"
 )
@@ -23,166 +21,323 @@ var (
 	gasLimitNonInitializedAccount uint64 = 52000
 )
 
+// backend is the node API used by the builder, a contract backend that can
+// also read native coin balances.
+type backend interface {
+	bind.ContractBackend
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+}
+
 type TxBuilder interface {
 	Sender() common.Address
-	GetContractInstance() *bindings.Token
+	Accounts() []Account
+	Providers() []ProviderStatus
+	ChainID() *big.Int
+	GetContractInstance(token common.Address) *bindings.Token
 	TransferETH(ctx context.Context, to string, value *big.Int) (common.Hash, error)
-	TransferERC20(ctx context.Context, to string, value *big.Int, balance *big.Int) (common.Hash, error)
+	TransferERC20(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error)
+	TransferFromERC20(ctx context.Context, token, from common.Address, to string, value *big.Int) (common.Hash, error)
+	MintERC20(ctx context.Context, token common.Address, to string, value *big.Int) (common.Hash, error)
+	CheckMinter(ctx context.Context, token common.Address) error
+	DisperseETH(ctx context.Context, disperse common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error)
+	DisperseERC20(ctx context.Context, disperse, token common.Address, recipients []common.Address, values []*big.Int) (common.Hash, error)
+	ApproveDisperse(ctx context.Context, disperse, token common.Address) error
+	TransactionState(hash common.Hash) (TxState, bool)
+	WatchTransaction(hash common.Hash)
+	BlockNumber(ctx context.Context) (uint64, error)
+	SentTransfers(ctx context.Context, token common.Address, fromBlock, toBlock uint64, relays ...common.Address) ([]Transfer, error)
+	MintedTransfers(ctx context.Context, token common.Address, fromBlock, toBlock uint64) ([]Transfer, error)
+	BalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+	TokenBalance(ctx context.Context, token, account common.Address) (*big.Int, error)
+	Allowance(ctx context.Context, token, owner, spender common.Address) (*big.Int, error)
 }
 
 type TxBuild struct {
-	client           bind.ContractBackend
-	privateKey       *ecdsa.PrivateKey
-	signer           types.Signer
-	fromAddress      common.Address
-	nonce            uint64
-	chainID          *big.Int
-	tokenAddress     string
-	contractInstance *bindings.Token
-}
-
-func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, tokenAddress string, chainID *big.Int) (TxBuilder, error) {
-	client, err := ethclient.Dial(provider)
+	client        backend
+	providers     *ProviderPool
+	wallets       []*wallet
+	next          atomic.Uint64
+	signer        types.Signer
+	chainID       *big.Int
+	tokens        map[common.Address]*bindings.Token
+	legacyTx      bool
+	maxFeeCap     *big.Int
+	maxTipCap     *big.Int
+	confirmations uint64
+	watcher       *ReceiptWatcher
+	stuckTimeout  time.Duration
+	maxReplaceFee *big.Int
+	gasMultiplier float64
+	gasCap        uint64
+}
+
+// Option configures optional behavior of a TxBuild.
+type Option func(*TxBuild)
+
+// WithFeeCaps limits the fee per gas and the priority fee per gas the faucet
+// is willing to pay. A nil cap leaves the corresponding fee unbounded.
+func WithFeeCaps(maxFeeCap, maxTipCap *big.Int) Option {
+	return func(b *TxBuild) {
+		b.maxFeeCap = maxFeeCap
+		b.maxTipCap = maxTipCap
+	}
+}
+
+// WithLegacyTx makes the builder send legacy transactions priced with
+// eth_gasPrice, for networks that do not support dynamic fee transactions.
+func WithLegacyTx(legacy bool) Option {
+	return func(b *TxBuild) {
+		b.legacyTx = legacy
+	}
+}
+
+// WithConfirmations sets the number of blocks a transaction must be buried
+// under before the receipt watcher reports it as confirmed.
+func WithConfirmations(confirmations uint64) Option {
+	return func(b *TxBuild) {
+		b.confirmations = confirmations
+	}
+}
+
+// WithStuckTxReplacement re-signs transactions that are not mined within
+// timeout with bumped fees, up to maxFeeCap. A zero timeout disables it.
+func WithStuckTxReplacement(timeout time.Duration, maxFeeCap *big.Int) Option {
+	return func(b *TxBuild) {
+		b.stuckTimeout = timeout
+		b.maxReplaceFee = maxFeeCap
+	}
+}
+
+// WithGasEstimation multiplies the estimated gas of token transfers by
+// multiplier and caps the resulting gas limit at gasCap.
+func WithGasEstimation(multiplier float64, gasCap uint64) Option {
+	return func(b *TxBuild) {
+		b.gasMultiplier = multiplier
+		b.gasCap = gasCap
+	}
+}
+
+// NewTxBuilder creates a builder funding transfers from the accounts of
+// privateKeys. The first account is the Sender, transfers are spread over all
+// of them. Requests go to the healthiest of the providers RPC endpoints, which
+// must all serve chainID, or the same chain when chainID is nil.
+func NewTxBuilder(providers []string, privateKeys []*ecdsa.PrivateKey, tokenAddresses []string, chainID *big.Int, opts ...Option) (TxBuilder, error) {
+	if len(privateKeys) == 0 {
+		return nil, errors.New("no funding account configured")
+	}
+	client, err := DialProviders(providers)
 	if err != nil {
 		return nil, err
 	}
+	go client.Run(context.Background())
+
+	// A provider serving another network would get transactions signed for
+	// the configured one
+	verifyCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if chainID, err = client.VerifyChainID(verifyCtx, chainID); err != nil {
+		return nil, err
+	}
 
-	if chainID == nil {
-		chainID, err = client.ChainID(context.Background())
+	tokens := make(map[common.Address]*bindings.Token, len(tokenAddresses))
+	for _, tokenAddress := range tokenAddresses {
+		address := common.HexToAddress(tokenAddress)
+		tokens[address], err = bindings.NewToken(address, client)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	contractInstance, err := bindings.NewToken(common.HexToAddress(tokenAddress), client)
-	if err != nil {
-		return nil, err
+	wallets := make([]*wallet, len(privateKeys))
+	for i, privateKey := range privateKeys {
+		wallets[i] = newWallet(client, privateKey)
 	}
-
 	txBuilder := &TxBuild{
-		client:           client,
-		privateKey:       privateKey,
-		signer:           types.NewEIP155Signer(chainID),
-		fromAddress:      crypto.PubkeyToAddress(privateKey.PublicKey),
-		chainID:          chainID,
-		tokenAddress:     tokenAddress,
-		contractInstance: contractInstance,
+		client:    client,
+		providers: client,
+		wallets:   wallets,
+		signer:    types.LatestSignerForChainID(chainID),
+		chainID:   chainID,
+		tokens:    tokens,
+	}
+	for _, opt := range opts {
+		opt(txBuilder)
+	}
+	txBuilder.watcher = NewReceiptWatcher(client, txBuilder.confirmations)
+	txBuilder.watcher.onDropped = txBuilder.dropped
+	go txBuilder.watcher.Run(context.Background())
+	if txBuilder.stuckTimeout > 0 {
+		go NewStuckTxMonitor(txBuilder, txBuilder.stuckTimeout, txBuilder.maxReplaceFee).Run(context.Background())
 	}
-	txBuilder.refreshNonce(context.Background())
 
 	return txBuilder, nil
 }
 
+// Sender returns the primary funding account.
 func (b *TxBuild) Sender() common.Address {
-	return b.fromAddress
+	return b.wallets[0].address
 }
 
-func (b *TxBuild) GetContractInstance() *bindings.Token {
-	return b.contractInstance
+// ChainID returns the chain the transactions are signed for, verified
+// against the RPC endpoints.
+func (b *TxBuild) ChainID() *big.Int {
+	return b.chainID
 }
 
-func (b *TxBuild) TransferETH(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
-	gasLimit := uint64(21000)
-	gasPrice, err := b.client.SuggestGasPrice(ctx)
-	if err != nil {
-		return common.Hash{}, err
+// Providers returns the health of the RPC endpoints.
+func (b *TxBuild) Providers() []ProviderStatus {
+	if b.providers == nil {
+		return nil
 	}
+	return b.providers.Status()
+}
 
-	toAddress := common.HexToAddress(to)
-	unsignedTx := types.NewTx(&types.LegacyTx{
-		Nonce:    b.getAndIncrementNonce(),
-		To:       &toAddress,
-		Value:    value,
-		Gas:      gasLimit,
-		GasPrice: gasPrice,
-	})
+// BalanceAt returns the native coin balance of account at the latest block.
+func (b *TxBuild) BalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	return b.client.BalanceAt(ctx, account, nil)
+}
 
-	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
+// TokenBalance returns the balance of token held by account.
+func (b *TxBuild) TokenBalance(ctx context.Context, token, account common.Address) (*big.Int, error) {
+	caller, err := bindings.NewTokenCaller(token, b.client)
 	if err != nil {
-		return common.Hash{}, err
+		return nil, err
 	}
+	return caller.BalanceOf(&bind.CallOpts{Context: ctx}, account)
+}
 
-	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
-		log.Error("failed to send tx", "tx hash", signedTx.Hash().String(), "err", err)
-		if strings.Contains(err.Error(), "nonce") {
-			b.refreshNonce(context.Background())
-		}
-		return common.Hash{}, err
+// Allowance returns the amount of token that spender may transfer on behalf
+// of owner.
+func (b *TxBuild) Allowance(ctx context.Context, token, owner, spender common.Address) (*big.Int, error) {
+	caller, err := bindings.NewTokenCaller(token, b.client)
+	if err != nil {
+		return nil, err
 	}
+	return caller.Allowance(&bind.CallOpts{Context: ctx}, owner, spender)
+}
 
-	return signedTx.Hash(), nil
+// GetContractInstance returns the binding of a token the builder was created
+// with, or nil for an unknown token.
+func (b *TxBuild) GetContractInstance(token common.Address) *bindings.Token {
+	return b.tokens[token]
 }
 
-func (b *TxBuild) TransferERC20(ctx context.Context, to string, value *big.Int, balance *big.Int) (common.Hash, error) {
-	emptyHash := common.Hash{}
-	publicKey := b.privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return emptyHash, fmt.Errorf("invalid type: publicKey is not of type *ecdsa.PublicKey")
+// TransactionState returns the state of a transaction sent by the builder as
+// last observed by the receipt watcher.
+func (b *TxBuild) TransactionState(hash common.Hash) (TxState, bool) {
+	if b.watcher == nil {
+		return TxState{}, false
 	}
+	return b.watcher.State(hash)
+}
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := b.client.PendingNonceAt(ctx, fromAddress)
-	if err != nil {
-		return emptyHash, err
+// WatchTransaction makes the receipt watcher follow a transaction broadcast
+// before a restart, so TransactionState reports it again.
+func (b *TxBuild) WatchTransaction(hash common.Hash) {
+	if b.watcher != nil {
+		b.watcher.TrackHash(hash)
 	}
+}
 
-	gasPrice, err := b.client.SuggestGasPrice(ctx)
-	if err != nil {
-		return emptyHash, err
-	}
+func (b *TxBuild) TransferETH(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	return b.sendFromPool(ctx, b.candidates(), common.HexToAddress(to), value, nil)
+}
 
+func (b *TxBuild) TransferERC20(ctx context.Context, tokenAddress common.Address, to string, value *big.Int) (common.Hash, error) {
 	toAddress := common.HexToAddress(to)
-	tokenAddress := common.HexToAddress(b.tokenAddress)
 
-	transferFnSignature := []byte("transfer(address,uint256)")
-	hash := sha3.NewLegacyKeccak256()
-	hash.Write(transferFnSignature)
-	methodID := hash.Sum(nil)[:4]
+	var data []byte
+	data = append(data, methodID("transfer(address,uint256)")...)
+	data = append(data, addLeftPadding(toAddress.Bytes())...)
+	data = append(data, addLeftPadding(value.Bytes())...)
 
-	paddedAddress := addLeftPadding(toAddress.Bytes())
-	paddedAmount := addLeftPadding(value.Bytes())
+	return b.sendFromPool(ctx, b.candidates(), tokenAddress, nil, data)
+}
+
+// TransferFromERC20 transfers value of token from an account that approved
+// the Sender to spend its tokens.
+func (b *TxBuild) TransferFromERC20(ctx context.Context, tokenAddress, from common.Address, to string, value *big.Int) (common.Hash, error) {
+	toAddress := common.HexToAddress(to)
 
 	var data []byte
-	data = append(data, methodID...)
-	data = append(data, paddedAddress...)
-	data = append(data, paddedAmount...)
+	data = append(data, methodID("transferFrom(address,address,uint256)")...)
+	data = append(data, addLeftPadding(from.Bytes())...)
+	data = append(data, addLeftPadding(toAddress.Bytes())...)
+	data = append(data, addLeftPadding(value.Bytes())...)
 
-	var gasLimit uint64
-	if balance.BitLen() == 0 {
-		gasLimit = gasLimitNonInitializedAccount
-	} else {
-		gasLimit = gasLimitInitializedAccount
-	}
+	// The allowance is granted to the primary account only
+	return b.sendFromPool(ctx, b.wallets[:1], tokenAddress, nil, data)
+}
 
-	tx := types.NewTransaction(nonce, tokenAddress, big.NewInt(0), gasLimit, gasPrice, data)
+// methodID returns the selector of a contract method signature.
+func methodID(signature string) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(signature))
+	return hash.Sum(nil)[:4]
+}
 
-	signedTx, err := types.SignTx(tx, b.signer, b.privateKey)
-	if err != nil {
-		return emptyHash, err
-	}
+// BroadcastError is returned when a signed transaction could not be broadcast.
+// The node may have received the transaction nonetheless, so it may still be
+// mined.
+type BroadcastError struct {
+	Hash common.Hash
+	Err  error
+}
 
-	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
-		log.Error("failed to send tx", "tx hash", signedTx.Hash().String(), "err", err)
-		if strings.Contains(err.Error(), "nonce") {
-			b.refreshNonce(ctx)
-		}
-		return emptyHash, err
-	}
+func (e *BroadcastError) Error() string {
+	return e.Err.Error()
+}
 
-	return signedTx.Hash(), nil
+func (e *BroadcastError) Unwrap() error {
+	return e.Err
 }
 
-func (b *TxBuild) getAndIncrementNonce() uint64 {
-	return atomic.AddUint64(&b.nonce, 1) - 1
+type signedHookKey struct{}
+
+// WithSignedHook returns a context that makes the transactions sent with it
+// call hook with their hash once they are signed, before they are broadcast.
+// A transaction signed again with another nonce calls hook again. The hook
+// runs while the nonce of the sending account is locked, so it must return
+// quickly and must not send transactions itself.
+func WithSignedHook(ctx context.Context, hook func(common.Hash)) context.Context {
+	return context.WithValue(ctx, signedHookKey{}, hook)
 }
 
-func (b *TxBuild) refreshNonce(ctx context.Context) {
-	nonce, err := b.client.PendingNonceAt(ctx, b.Sender())
+// send signs and broadcasts the transaction built by newTx from w. Nonces are
+// handed out by the nonce manager of the wallet, so concurrent transfers never
+// share a nonce.
+func (b *TxBuild) send(ctx context.Context, w *wallet, newTx func(nonce uint64) *types.Transaction) (common.Hash, error) {
+	var txHash common.Hash
+	err := w.nonces.send(ctx, func(nonce uint64) error {
+		signedTx, err := types.SignTx(newTx(nonce), b.signer, w.privateKey)
+		if err != nil {
+			return err
+		}
+		if hook, ok := ctx.Value(signedHookKey{}).(func(common.Hash)); ok {
+			hook(signedTx.Hash())
+		}
+
+		// A transaction the node already knows was broadcast before, signing
+		// another one at a new nonce would pay the recipient twice
+		if err = b.client.SendTransaction(ctx, signedTx); err != nil && !isAlreadyKnown(err) {
+			log.WithError(err).WithFields(log.Fields{
+				"txHash": signedTx.Hash().String(),
+				"nonce":  nonce,
+				"from":   w.address,
+			}).Error("failed to send tx")
+			return &BroadcastError{Hash: signedTx.Hash(), Err: err}
+		}
+
+		txHash = signedTx.Hash()
+		if b.watcher != nil {
+			b.watcher.Track(signedTx)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Error("failed to refresh nonce", "address", b.Sender(), "err", err)
-		return
+		return common.Hash{}, err
 	}
 
-	b.nonce = nonce
+	return txHash, nil
 }
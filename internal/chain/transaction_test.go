@@ -9,10 +9,12 @@ import (
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient/simulated"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTxBuilder_TransferETH(t *testing.T) {
@@ -30,12 +32,10 @@ func TestTxBuilder_TransferETH(t *testing.T) {
 	defer patches.Reset()
 
 	txBuilder := &TxBuild{
-		client:       simBackend.Client(),
-		privateKey:   privateKey,
-		signer:       types.NewEIP155Signer(big.NewInt(1337)),
-		fromAddress:  crypto.PubkeyToAddress(privateKey.PublicKey),
-		chainID:      big.NewInt(1337),
-		tokenAddress: "0xbb5801a7D398351b8bE11C439e05C5B3259aeux0",
+		client:  simBackend.Client(),
+		wallets: []*wallet{newWallet(simBackend.Client(), privateKey)},
+		signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+		chainID: big.NewInt(1337),
 	}
 	bgCtx := context.Background()
 	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
@@ -63,20 +63,49 @@ func TestTxBuilder_TransferETH(t *testing.T) {
 	}
 }
 
+func TestTxBuilder_SignedHook(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	client := &flakyClient{Client: simBackend.Client()}
+	txBuilder.client = client
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	var signed []common.Hash
+	signedCtx := WithSignedHook(bgCtx, func(hash common.Hash) { signed = append(signed, hash) })
+	txHash, err := txBuilder.TransferETH(signedCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{txHash}, signed)
+
+	// The hook runs before the broadcast, also for a transaction the node refuses
+	signed = nil
+	client.failures.Store(1)
+	_, err = txBuilder.TransferETH(signedCtx, toAddress.Hex(), big.NewInt(1))
+	var broadcastErr *BroadcastError
+	require.ErrorAs(t, err, &broadcastErr)
+	require.Len(t, signed, 1)
+	assert.Equal(t, signed[0], broadcastErr.Hash)
+
+	// Transactions sent without the hook leave it alone
+	signed = nil
+	_, err = txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1))
+	require.NoError(t, err)
+	assert.Empty(t, signed)
+}
+
 func TestTxBuilder_TransferERC20(t *testing.T) {
 	testcases := []struct {
 		name         string
-		accBalance   *big.Int
+		tokenCode    []byte
 		wantGasLimit uint64
 	}{
 		{
-			name:         "should use appropriate gas limit for transaction when recipient is initialized",
-			accBalance:   big.NewInt(30000),
+			name:         "should fall back to appropriate gas limit for transaction when recipient is initialized",
+			tokenCode:    mockTokenCode,
 			wantGasLimit: gasLimitInitializedAccount,
 		},
 		{
-			name:         "should use appropriate gas limit for transaction when recipient is not initialized",
-			accBalance:   big.NewInt(0),
+			name:         "should fall back to appropriate gas limit for transaction when recipient is not initialized",
+			tokenCode:    nil,
 			wantGasLimit: gasLimitNonInitializedAccount,
 		},
 	}
@@ -86,9 +115,11 @@ func TestTxBuilder_TransferERC20(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
 			fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+			tokenAddress := common.HexToAddress("0xbb5801a7D398351b8bE11C439e05C5B3259aeux0")
 			simBackend := simulated.NewBackend(
 				types.GenesisAlloc{
-					fromAddress: {Balance: big.NewInt(10000000000000000)},
+					fromAddress:  {Balance: big.NewInt(10000000000000000)},
+					tokenAddress: {Code: tc.tokenCode, Balance: big.NewInt(0)},
 				})
 
 			defer simBackend.Close()
@@ -99,19 +130,16 @@ func TestTxBuilder_TransferERC20(t *testing.T) {
 			defer patches.Reset()
 
 			txBuilder := &TxBuild{
-				client:           simBackend.Client(),
-				privateKey:       privateKey,
-				signer:           types.NewEIP155Signer(big.NewInt(1337)),
-				fromAddress:      crypto.PubkeyToAddress(privateKey.PublicKey),
-				chainID:          big.NewInt(1337),
-				tokenAddress:     "0xbb5801a7D398351b8bE11C439e05C5B3259aeux0",
-				contractInstance: nil,
+				client:  &noEstimateClient{Client: simBackend.Client()},
+				wallets: []*wallet{newWallet(simBackend.Client(), privateKey)},
+				signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+				chainID: big.NewInt(1337),
 			}
 			bgCtx := context.Background()
 			toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
 			value := big.NewInt(1000)
 
-			txHashInitAcc, err := txBuilder.TransferERC20(bgCtx, toAddress.Hex(), value, tc.accBalance)
+			txHashInitAcc, err := txBuilder.TransferERC20(bgCtx, tokenAddress, toAddress.Hex(), value)
 			if err != nil {
 				t.Errorf("could not add tx to pending block: %v", err)
 			}
@@ -137,3 +165,40 @@ func TestTxBuilder_TransferERC20(t *testing.T) {
 		})
 	}
 }
+
+func TestTxBuilder_Balances(t *testing.T) {
+	txBuilder, _ := newTestTokenBuilder(t, mockTokenCode)
+	bgCtx := context.Background()
+
+	balance, err := txBuilder.BalanceAt(bgCtx, txBuilder.Sender())
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(10000000000000000), balance)
+
+	tokenBalance, err := txBuilder.TokenBalance(bgCtx, testTokenAddress, txBuilder.Sender())
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), tokenBalance)
+}
+
+func TestTxBuilder_TransferFromERC20(t *testing.T) {
+	txBuilder, simBackend := newTestTokenBuilder(t, mockTokenCode)
+	bgCtx := context.Background()
+	treasury := common.HexToAddress("0x0000000000000000000000000000000000000bEE")
+
+	allowance, err := txBuilder.Allowance(bgCtx, testTokenAddress, treasury, txBuilder.Sender())
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), allowance)
+
+	txHash, err := txBuilder.TransferFromERC20(bgCtx, testTokenAddress, treasury, txBuilder.Sender().Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	tx, _, err := simBackend.Client().TransactionByHash(bgCtx, txHash)
+	require.NoError(t, err)
+	assert.Equal(t, testTokenAddress, *tx.To())
+	data := tx.Data()
+	require.Len(t, data, 4+3*32)
+	assert.Equal(t, hexutil.MustDecode("0x23b872dd"), data[:4])
+	assert.Equal(t, treasury, common.BytesToAddress(data[4:36]))
+	assert.Equal(t, txBuilder.Sender(), common.BytesToAddress(data[36:68]))
+	assert.Equal(t, big.NewInt(1000), new(big.Int).SetBytes(data[68:]))
+}
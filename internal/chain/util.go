@@ -1,10 +1,13 @@
 package chain
 
 import (
-	"math"
+	"encoding/hex"
+	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 func Has0xPrefix(str string) bool {
@@ -18,16 +21,73 @@ func IsValidAddress(address string, checksummed bool) bool {
 	return !checksummed || common.HexToAddress(address).Hex() == address
 }
 
+func IsValidTxHash(hash string) bool {
+	if Has0xPrefix(hash) {
+		hash = hash[2:]
+	}
+	if len(hash) != 2*common.HashLength {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
 func addLeftPadding(input []byte) []byte {
 	return common.LeftPadBytes(input, 32)
 }
 
-func TokenToWei(amount float64, decimals int) *big.Int {
-	ethDecimals := 18
-	oneEthToWei := math.Pow10(ethDecimals)
+// ParseUnits converts a decimal amount such as "0.1" into the base units of a
+// token with the given decimals. Amounts with more fractional digits than the
+// token supports are rejected rather than rounded.
+func ParseUnits(amount string, decimals int) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("invalid decimals %d", decimals)
+	}
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", amount, decimals)
+	}
+
+	value, _ := new(big.Int).SetString(whole+frac+strings.Repeat("0", decimals-len(frac)), 10)
+	return value, nil
+}
 
-	amountInt := int64(amount * oneEthToWei)
+// FormatUnits converts base units of a token with the given decimals into a
+// decimal amount without trailing zeros.
+func FormatUnits(value *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(value).String()
+	sign := ""
+	if value.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole, frac := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+func isDigits(str string) bool {
+	for _, c := range str {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
 
-	oneTokenInWei := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
-	return new(big.Int).Div(new(big.Int).Mul(big.NewInt(amountInt), oneTokenInWei), big.NewInt(int64(oneEthToWei)))
+func GweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(params.GWei)).Int(nil)
+	return wei
 }
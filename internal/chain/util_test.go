@@ -34,19 +34,120 @@ func TestIsValidAddress(t *testing.T) {
 	}
 }
 
-func TestTokenToWei(t *testing.T) {
+func TestIsValidTxHash(t *testing.T) {
 	tests := []struct {
-		name          string
-		amount        float64
-		tokenDecimals int
-		want          *big.Int
+		name string
+		hash string
+		want bool
+	}{
+		{name: "valid hash", hash: "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b", want: true},
+		{name: "hash without 0x", hash: "88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b", want: true},
+		{name: "short hash", hash: "0x88df0164", want: false},
+		{name: "invalid characters", hash: "0xzzdf016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidTxHash(tt.hash); got != tt.want {
+				t.Errorf("IsValidTxHash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		decimals int
+		want     string
+		wantErr  bool
+	}{
+		{name: "1ether", amount: "1", decimals: 18, want: "1000000000000000000"},
+		{name: "fraction", amount: "0.1", decimals: 18, want: "100000000000000000"},
+		{name: "leading dot", amount: ".5", decimals: 6, want: "500000"},
+		{name: "trailing dot", amount: "2.", decimals: 6, want: "2000000"},
+		{name: "large amount", amount: "1000000000000", decimals: 18, want: "1000000000000000000000000000000"},
+		{name: "smallest unit", amount: "0.000000000000000000000000000000000001", decimals: 36, want: "1"},
+		{name: "36 decimals", amount: "123456.789", decimals: 36, want: "123456789000000000000000000000000000000000"},
+		{name: "0 decimals", amount: "42", decimals: 0, want: "42"},
+		{name: "trailing zeros beyond decimals", amount: "42.000", decimals: 0, want: "42"},
+		{name: "too many decimals", amount: "0.1234567", decimals: 6, wantErr: true},
+		{name: "fraction of 0 decimals", amount: "0.5", decimals: 0, wantErr: true},
+		{name: "negative", amount: "-1", decimals: 18, wantErr: true},
+		{name: "exponent", amount: "1e18", decimals: 18, wantErr: true},
+		{name: "empty", amount: "", decimals: 18, wantErr: true},
+		{name: "dot only", amount: ".", decimals: 18, wantErr: true},
+		{name: "negative decimals", amount: "1", decimals: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUnits(tt.amount, tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUnits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		decimals int
+		want     string
+	}{
+		{name: "1ether", value: "1000000000000000000", decimals: 18, want: "1"},
+		{name: "fraction", value: "100000000000000000", decimals: 18, want: "0.1"},
+		{name: "zero", value: "0", decimals: 18, want: "0"},
+		{name: "large amount", value: "1000000000000000000000000000000", decimals: 18, want: "1000000000000"},
+		{name: "smallest unit", value: "1", decimals: 36, want: "0.000000000000000000000000000000000001"},
+		{name: "0 decimals", value: "42", decimals: 0, want: "42"},
+		{name: "negative", value: "-1500000", decimals: 6, want: "-1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _ := new(big.Int).SetString(tt.value, 10)
+			if got := FormatUnits(value, tt.decimals); got != tt.want {
+				t.Errorf("FormatUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for decimals := 0; decimals <= 36; decimals++ {
+		value, err := ParseUnits("123456789.123456789", decimals)
+		if decimals < 9 {
+			if err == nil {
+				t.Errorf("ParseUnits() expected error for %d decimals", decimals)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseUnits() error = %v", err)
+		}
+		if got := FormatUnits(value, decimals); got != "123456789.123456789" {
+			t.Errorf("FormatUnits() = %v with %d decimals, want 123456789.123456789", got, decimals)
+		}
+	}
+}
+
+func TestGweiToWei(t *testing.T) {
+	tests := []struct {
+		name string
+		gwei float64
+		want *big.Int
 	}{
-		{name: "1ether", amount: 1, tokenDecimals: 18, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+		{name: "zero", gwei: 0, want: big.NewInt(0)},
+		{name: "1gwei", gwei: 1, want: big.NewInt(1000000000)},
+		{name: "fractional", gwei: 0.001, want: big.NewInt(1000000)},
+		{name: "large", gwei: 50000, want: big.NewInt(50000000000000)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := TokenToWei(tt.amount, tt.tokenDecimals); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("EtherToWei() = %v, want %v", got, tt.want)
+			if got := GweiToWei(tt.gwei); got.Cmp(tt.want) != 0 {
+				t.Errorf("GweiToWei() = %v, want %v", got, tt.want)
 			}
 		})
 	}
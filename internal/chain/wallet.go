@@ -0,0 +1,165 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+)
+
+var errInsufficientFunds = errors.New("no funding account holds enough balance for the transaction")
+
+// wallet is a funding account of the faucet. Every wallet has its own nonce
+// sequence, so transfers sent from different wallets never queue behind each
+// other.
+type wallet struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+	nonces     *nonceManager
+}
+
+func newWallet(client pendingNonceReader, privateKey *ecdsa.PrivateKey) *wallet {
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	return &wallet{
+		privateKey: privateKey,
+		address:    address,
+		nonces:     newNonceManager(client, address),
+	}
+}
+
+// Account is a funding account of the faucet with the number of its
+// transactions that are not mined yet.
+type Account struct {
+	Address common.Address
+	Pending int
+}
+
+// Accounts returns the funding accounts of the faucet, starting with the
+// Sender.
+func (b *TxBuild) Accounts() []Account {
+	accounts := make([]Account, len(b.wallets))
+	for i, w := range b.wallets {
+		accounts[i] = Account{Address: w.address, Pending: b.pending(w.address)}
+	}
+	return accounts
+}
+
+func (b *TxBuild) pending(account common.Address) int {
+	if b.watcher == nil {
+		return 0
+	}
+	return b.watcher.Pending(account)
+}
+
+// wallet returns the funding wallet of account.
+func (b *TxBuild) wallet(account common.Address) (*wallet, bool) {
+	for _, w := range b.wallets {
+		if w.address == account {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// dropped resyncs the nonce of the wallet that sent a transaction dropped
+// from the mempool, so the next transaction fills the nonce it freed instead
+// of queueing behind it.
+func (b *TxBuild) dropped(from common.Address, nonce uint64) {
+	w, ok := b.wallet(from)
+	if !ok {
+		return
+	}
+	log.WithFields(log.Fields{
+		"account": from,
+		"nonce":   nonce,
+	}).Warn("transaction dropped, resyncing nonce")
+	w.nonces.resync()
+}
+
+// candidates returns the wallets ordered by their number of pending
+// transactions. Ties rotate between calls, so idle wallets take turns.
+func (b *TxBuild) candidates() []*wallet {
+	n := len(b.wallets)
+	start := int(b.next.Add(1)-1) % n
+	ordered := make([]*wallet, n)
+	pending := make(map[common.Address]int, n)
+	for i := range b.wallets {
+		ordered[i] = b.wallets[(start+i)%n]
+		pending[ordered[i].address] = b.pending(ordered[i].address)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return pending[ordered[i].address] < pending[ordered[j].address]
+	})
+	return ordered
+}
+
+// sendFromPool sends value and data to the first of the wallets that can
+// afford it. Contract calls are simulated from every candidate, so a wallet
+// lacking the tokens or permissions for the call is skipped. The balance of a
+// candidate is only checked when there is another wallet to fall back to,
+// otherwise the node reports the failure. The first error is returned when no
+// wallet can send.
+func (b *TxBuild) sendFromPool(ctx context.Context, wallets []*wallet, to common.Address, value *big.Int, data []byte) (common.Hash, error) {
+	return b.sendBatchFromPool(ctx, wallets, to, value, data, 1)
+}
+
+// sendBatchFromPool is sendFromPool for a call making the given number of
+// transfers, whose gas limit is capped at the gas cap of a transfer times
+// transfers.
+func (b *TxBuild) sendBatchFromPool(ctx context.Context, wallets []*wallet, to common.Address, value *big.Int, data []byte, transfers int) (common.Hash, error) {
+	fees, err := b.suggestFees(ctx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	var firstErr error
+	for _, w := range wallets {
+		gasLimit, err := b.prepare(ctx, w, to, value, data, transfers)
+		if err == nil && len(wallets) > 1 {
+			err = b.checkFunds(ctx, w, fees.maxCost(gasLimit, value))
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			log.WithError(err).WithField("account", w.address).Debug("funding account cannot send transaction")
+			continue
+		}
+
+		return b.send(ctx, w, func(nonce uint64) *types.Transaction {
+			return fees.newTx(b.chainID, nonce, to, value, gasLimit, data)
+		})
+	}
+	return common.Hash{}, firstErr
+}
+
+// prepare returns the gas limit of a transaction from w making the given
+// number of transfers. Contract calls are simulated first, so a call that
+// would revert is never broadcast.
+func (b *TxBuild) prepare(ctx context.Context, w *wallet, to common.Address, value *big.Int, data []byte, transfers int) (uint64, error) {
+	if len(data) == 0 {
+		return 21000, nil
+	}
+	msg := callMsg(w.address, to, value, data)
+	if err := b.simulate(ctx, msg); err != nil {
+		return 0, err
+	}
+	return b.estimateGas(ctx, msg, transfers)
+}
+
+func (b *TxBuild) checkFunds(ctx context.Context, w *wallet, cost *big.Int) error {
+	balance, err := b.client.BalanceAt(ctx, w.address, nil)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(cost) < 0 {
+		return errInsufficientFunds
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPoolBuilder(t *testing.T, balances ...*big.Int) (*TxBuild, *simulated.Backend) {
+	alloc := make(types.GenesisAlloc, len(balances))
+	keys := make([]*ecdsa.PrivateKey, len(balances))
+	for i, balance := range balances {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = types.Account{Balance: balance}
+	}
+	simBackend := simulated.NewBackend(alloc)
+	t.Cleanup(func() { simBackend.Close() })
+
+	txBuilder := &TxBuild{
+		client:  simBackend.Client(),
+		signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+		chainID: big.NewInt(1337),
+		watcher: NewReceiptWatcher(simBackend.Client(), 1),
+	}
+	for _, key := range keys {
+		txBuilder.wallets = append(txBuilder.wallets, newWallet(simBackend.Client(), key))
+	}
+	return txBuilder, simBackend
+}
+
+func txSender(t *testing.T, simBackend *simulated.Backend, hash common.Hash) common.Address {
+	tx, _, err := simBackend.Client().TransactionByHash(context.Background(), hash)
+	require.NoError(t, err)
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(1337)), tx)
+	require.NoError(t, err)
+	return from
+}
+
+func TestTxBuilder_PoolLeastPending(t *testing.T) {
+	funds := big.NewInt(10000000000000000)
+	txBuilder, simBackend := newTestPoolBuilder(t, funds, funds)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	senders := make(map[common.Address]bool)
+	for i := 0; i < 2; i++ {
+		txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+		require.NoError(t, err)
+		senders[txSender(t, simBackend, txHash)] = true
+	}
+	assert.Len(t, senders, 2, "pending transfers should be spread over both wallets")
+	for _, account := range txBuilder.Accounts() {
+		assert.Equal(t, 1, account.Pending)
+	}
+	assert.Equal(t, txBuilder.wallets[0].address, txBuilder.Sender())
+}
+
+func TestTxBuilder_PoolSkipsUnfundedWallet(t *testing.T) {
+	txBuilder, simBackend := newTestPoolBuilder(t, big.NewInt(0), big.NewInt(10000000000000000))
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	for i := 0; i < 3; i++ {
+		txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+		require.NoError(t, err)
+		assert.Equal(t, txBuilder.wallets[1].address, txSender(t, simBackend, txHash))
+		simBackend.Commit()
+	}
+
+	_, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(10000000000000000))
+	assert.ErrorIs(t, err, errInsufficientFunds)
+}
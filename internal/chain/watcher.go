@@ -0,0 +1,323 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	receiptPollInterval = 3 * time.Second
+	txDropTimeout       = 10 * time.Minute
+	txStateRetention    = 24 * time.Hour
+)
+
+type TxStatus string
+
+const (
+	TxPending   TxStatus = "pending"
+	TxConfirmed TxStatus = "confirmed"
+	TxFailed    TxStatus = "failed"
+)
+
+// TxState is the last known state of a transaction sent by the faucet. Hash
+// is the latest replacement of the transaction, Replaced lists the hashes it
+// superseded.
+type TxState struct {
+	Hash          common.Hash
+	Status        TxStatus
+	BlockNumber   uint64
+	GasUsed       uint64
+	Confirmations uint64
+	Error         string
+	Replaced      []common.Hash
+}
+
+type receiptBackend interface {
+	ethereum.TransactionReader
+	ethereum.BlockNumberReader
+}
+
+// trackedTx is a transaction followed by the watcher. tx is nil for a
+// transaction only known by its hash, which is never replaced.
+type trackedTx struct {
+	from      common.Address
+	tx        *types.Transaction
+	hashes    []common.Hash
+	state     TxState
+	sentAt    time.Time
+	unseenAt  time.Time
+	updatedAt time.Time
+}
+
+// ReceiptWatcher follows sent transactions until they reach the configured
+// confirmation depth, revert or are dropped from the mempool.
+type ReceiptWatcher struct {
+	mutex         sync.RWMutex
+	client        receiptBackend
+	confirmations uint64
+	interval      time.Duration
+	dropTimeout   time.Duration
+	txs           map[common.Hash]*trackedTx
+	// onDropped is called with the sender and nonce of every transaction
+	// dropped from the mempool, outside of the watcher lock
+	onDropped func(from common.Address, nonce uint64)
+}
+
+func NewReceiptWatcher(client receiptBackend, confirmations uint64) *ReceiptWatcher {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	return &ReceiptWatcher{
+		client:        client,
+		confirmations: confirmations,
+		interval:      receiptPollInterval,
+		dropTimeout:   txDropTimeout,
+		txs:           make(map[common.Hash]*trackedTx),
+	}
+}
+
+// Track starts following a transaction that has been broadcast.
+func (w *ReceiptWatcher) Track(tx *types.Transaction) {
+	// The sender is only used to count pending transactions per account
+	from, _ := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	now := time.Now()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.txs[tx.Hash()] = &trackedTx{
+		from:      from,
+		tx:        tx,
+		hashes:    []common.Hash{tx.Hash()},
+		state:     TxState{Hash: tx.Hash(), Status: TxPending},
+		sentAt:    now,
+		updatedAt: now,
+	}
+}
+
+// TrackHash starts following a transaction known only by its hash, such as a
+// transaction sent before a restart. A transaction the node does not know is
+// reported as dropped after the drop timeout.
+func (w *ReceiptWatcher) TrackHash(hash common.Hash) {
+	now := time.Now()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.txs[hash]; ok {
+		return
+	}
+	w.txs[hash] = &trackedTx{
+		hashes:    []common.Hash{hash},
+		state:     TxState{Hash: hash, Status: TxPending},
+		sentAt:    now,
+		updatedAt: now,
+	}
+}
+
+// Replace records that tx, which has the same nonce as the tracked
+// transaction old, has been broadcast to replace it. Lookups of any hash in
+// the chain of replacements return the state of the whole chain.
+func (w *ReceiptWatcher) Replace(old common.Hash, tx *types.Transaction) {
+	now := time.Now()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	tracked, ok := w.txs[old]
+	if !ok {
+		return
+	}
+	tracked.tx = tx
+	tracked.hashes = append(tracked.hashes, tx.Hash())
+	tracked.state.Hash = tx.Hash()
+	tracked.sentAt = now
+	tracked.unseenAt = time.Time{}
+	w.txs[tx.Hash()] = tracked
+}
+
+// State returns the last known state of a tracked transaction.
+func (w *ReceiptWatcher) State(hash common.Hash) (TxState, bool) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	tracked, ok := w.txs[hash]
+	if !ok {
+		return TxState{}, false
+	}
+	state := tracked.state
+	for _, h := range tracked.hashes {
+		if h != state.Hash {
+			state.Replaced = append(state.Replaced, h)
+		}
+	}
+	return state, true
+}
+
+// Pending returns the number of tracked transactions sent by account that are
+// not mined yet.
+func (w *ReceiptWatcher) Pending(account common.Address) int {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	pending := 0
+	for hash, tracked := range w.txs {
+		if hash == tracked.hashes[0] && tracked.from == account && tracked.state.Status == TxPending && tracked.state.BlockNumber == 0 {
+			pending++
+		}
+	}
+	return pending
+}
+
+// stuck returns the latest version of every transaction that has not been
+// mined within timeout of its last broadcast.
+func (w *ReceiptWatcher) stuck(timeout time.Duration) []*types.Transaction {
+	now := time.Now()
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	var txs []*types.Transaction
+	for hash, tracked := range w.txs {
+		if tracked.tx == nil || hash != tracked.tx.Hash() || tracked.state.Status != TxPending || tracked.state.BlockNumber != 0 {
+			continue
+		}
+		if now.Sub(tracked.sentAt) >= timeout {
+			txs = append(txs, tracked.tx)
+		}
+	}
+	return txs
+}
+
+// Run polls the node for receipts until the context is canceled.
+func (w *ReceiptWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll(ctx)
+		}
+	}
+}
+
+func (w *ReceiptWatcher) poll(ctx context.Context) {
+	head, err := w.client.BlockNumber(ctx)
+	if err != nil {
+		log.WithError(err).Error("failed to fetch latest block number")
+		return
+	}
+
+	now := time.Now()
+	for _, item := range w.pending(now) {
+		tracked := item.tracked
+		state, unseen := w.check(ctx, item.hashes, head)
+		dropped := false
+		w.mutex.Lock()
+		switch {
+		case unseen && tracked.unseenAt.IsZero():
+			tracked.unseenAt = now
+		case unseen && now.Sub(tracked.unseenAt) >= w.dropTimeout:
+			state.Status = TxFailed
+			state.Error = "transaction dropped from mempool"
+			dropped = true
+		case !unseen:
+			tracked.unseenAt = time.Time{}
+		}
+		if state.Hash == (common.Hash{}) {
+			state.Hash = tracked.state.Hash
+		}
+		if !state.equal(tracked.state) {
+			tracked.state = state
+			tracked.updatedAt = now
+			if state.Status != TxPending {
+				log.WithFields(log.Fields{
+					"txHash":      state.Hash,
+					"status":      state.Status,
+					"blockNumber": state.BlockNumber,
+				}).Info("Transaction finalized")
+			}
+		}
+		tx, from := tracked.tx, tracked.from
+		w.mutex.Unlock()
+
+		// The nonce of a transaction known only by its hash was synced on startup
+		if dropped && tx != nil && w.onDropped != nil {
+			w.onDropped(from, tx.Nonce())
+		}
+	}
+}
+
+type pollItem struct {
+	tracked *trackedTx
+	hashes  []common.Hash
+}
+
+// pending returns the transactions that still need to be polled and forgets
+// the finalized ones that are older than the retention period.
+func (w *ReceiptWatcher) pending(now time.Time) []pollItem {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var items []pollItem
+	for hash, tracked := range w.txs {
+		if hash != tracked.hashes[0] {
+			continue
+		}
+		if tracked.state.Status == TxPending {
+			items = append(items, pollItem{tracked: tracked, hashes: append([]common.Hash(nil), tracked.hashes...)})
+		} else if now.Sub(tracked.updatedAt) > txStateRetention {
+			for _, h := range tracked.hashes {
+				delete(w.txs, h)
+			}
+		}
+	}
+	return items
+}
+
+// check returns the current state of a chain of replacement transactions and
+// whether the node knows none of them. The state is taken from whichever
+// replacement has been mined.
+func (w *ReceiptWatcher) check(ctx context.Context, hashes []common.Hash, head uint64) (TxState, bool) {
+	state := TxState{Status: TxPending}
+	var receipt *types.Receipt
+	unseen := true
+	for i := len(hashes) - 1; i >= 0 && receipt == nil; i-- {
+		r, err := w.client.TransactionReceipt(ctx, hashes[i])
+		switch {
+		case err == nil:
+			receipt = r
+		case errors.Is(err, ethereum.NotFound):
+			if _, _, err := w.client.TransactionByHash(ctx, hashes[i]); !errors.Is(err, ethereum.NotFound) {
+				unseen = false
+			}
+		default:
+			log.WithError(err).WithField("txHash", hashes[i]).Error("failed to fetch transaction receipt")
+			unseen = false
+		}
+	}
+	if receipt == nil {
+		return state, unseen
+	}
+
+	state.Hash = receipt.TxHash
+	state.BlockNumber = receipt.BlockNumber.Uint64()
+	state.GasUsed = receipt.GasUsed
+	if head >= state.BlockNumber {
+		state.Confirmations = head - state.BlockNumber + 1
+	}
+	if state.Confirmations < w.confirmations {
+		return state, false
+	}
+
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		state.Status = TxConfirmed
+	} else {
+		state.Status = TxFailed
+		state.Error = "transaction reverted"
+	}
+	return state, false
+}
+
+func (s TxState) equal(o TxState) bool {
+	return s.Hash == o.Hash && s.Status == o.Status && s.BlockNumber == o.BlockNumber &&
+		s.GasUsed == o.GasUsed && s.Confirmations == o.Confirmations && s.Error == o.Error
+}
@@ -0,0 +1,140 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForIndexing polls until the simulated node, which indexes blocks
+// asynchronously, returns a receipt for hash or reports it as unknown.
+func waitForIndexing(t *testing.T, watcher *ReceiptWatcher, hash common.Hash) {
+	require.Eventually(t, func() bool {
+		_, err := watcher.client.TransactionReceipt(context.Background(), hash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return false
+		}
+		watcher.poll(context.Background())
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReceiptWatcher_Confirmations(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	txBuilder.watcher = NewReceiptWatcher(simBackend.Client(), 2)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+
+	txBuilder.watcher.poll(bgCtx)
+	state, ok := txBuilder.TransactionState(txHash)
+	require.True(t, ok)
+	assert.Equal(t, TxPending, state.Status)
+	assert.Zero(t, state.BlockNumber)
+
+	simBackend.Commit()
+	waitForIndexing(t, txBuilder.watcher, txHash)
+	state, _ = txBuilder.TransactionState(txHash)
+	assert.Equal(t, TxPending, state.Status)
+	assert.Equal(t, uint64(1), state.BlockNumber)
+	assert.Equal(t, uint64(1), state.Confirmations)
+
+	simBackend.Commit()
+	txBuilder.watcher.poll(bgCtx)
+	state, _ = txBuilder.TransactionState(txHash)
+	assert.Equal(t, TxConfirmed, state.Status)
+	assert.Equal(t, uint64(21000), state.GasUsed)
+	assert.Equal(t, uint64(2), state.Confirmations)
+}
+
+func TestReceiptWatcher_Reverted(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	revertingContract := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	simBackend := simulated.NewBackend(
+		types.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(10000000000000000)},
+			// PUSH1 0 PUSH1 0 REVERT
+			revertingContract: {Code: []byte{0x60, 0x00, 0x60, 0x00, 0xfd}},
+		})
+	defer simBackend.Close()
+
+	txBuilder := &TxBuild{
+		client:  simBackend.Client(),
+		wallets: []*wallet{newWallet(simBackend.Client(), privateKey)},
+		signer:  types.LatestSignerForChainID(big.NewInt(1337)),
+		chainID: big.NewInt(1337),
+		watcher: NewReceiptWatcher(simBackend.Client(), 1),
+	}
+	bgCtx := context.Background()
+
+	txHash, err := txBuilder.TransferETH(bgCtx, revertingContract.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	simBackend.Commit()
+
+	waitForIndexing(t, txBuilder.watcher, txHash)
+	state, ok := txBuilder.TransactionState(txHash)
+	require.True(t, ok)
+	assert.Equal(t, TxFailed, state.Status)
+	assert.Equal(t, uint64(1), state.BlockNumber)
+	assert.NotEmpty(t, state.Error)
+}
+
+func TestReceiptWatcher_Dropped(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	watcher := NewReceiptWatcher(simBackend.Client(), 1)
+	watcher.dropTimeout = 0
+	bgCtx := context.Background()
+	simBackend.Commit()
+	waitForIndexing(t, watcher, common.Hash{})
+
+	// The transaction is signed but never reaches the node
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	tx, err := types.SignTx(types.NewTransaction(0, toAddress, big.NewInt(1), 21000, big.NewInt(1), nil), txBuilder.signer, txBuilder.wallets[0].privateKey)
+	require.NoError(t, err)
+	watcher.Track(tx)
+
+	watcher.poll(bgCtx)
+	time.Sleep(time.Millisecond)
+	watcher.poll(bgCtx)
+	state, ok := watcher.State(tx.Hash())
+	require.True(t, ok)
+	assert.Equal(t, TxFailed, state.Status)
+	assert.Contains(t, state.Error, "dropped")
+
+	_, ok = watcher.State(common.HexToHash("0x01"))
+	assert.False(t, ok)
+}
+
+func TestReceiptWatcher_TrackHash(t *testing.T) {
+	txBuilder, simBackend := newTestTxBuilder(t)
+	bgCtx := context.Background()
+	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	// The transaction was sent before a restart, the new watcher only knows its hash
+	txHash, err := txBuilder.TransferETH(bgCtx, toAddress.Hex(), big.NewInt(1000))
+	require.NoError(t, err)
+	watcher := NewReceiptWatcher(simBackend.Client(), 1)
+	watcher.TrackHash(txHash)
+	assert.Empty(t, watcher.stuck(0), "a transaction known by its hash is never replaced")
+	assert.Zero(t, watcher.Pending(txBuilder.Sender()))
+
+	simBackend.Commit()
+	waitForIndexing(t, watcher, txHash)
+	state, ok := watcher.State(txHash)
+	require.True(t, ok)
+	assert.Equal(t, TxConfirmed, state.Status)
+	assert.Equal(t, uint64(1), state.BlockNumber)
+}
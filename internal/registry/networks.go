@@ -0,0 +1,120 @@
+package registry
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+)
+
+//go:embed networks.yaml
+var bundledNetworks []byte
+
+// Network describes a chain the faucet can serve. RPCURLs and Token are the
+// default providers and ERC20 token of the network, ExplorerURL and
+// ExplorerTxPath build the transaction links shown on the frontend and
+// NativeSymbol names the native coin.
+type Network struct {
+	Name           string   `yaml:"name"`
+	ChainID        uint64   `yaml:"chain_id"`
+	RPCURLs        []string `yaml:"rpc_urls"`
+	ExplorerURL    string   `yaml:"explorer_url"`
+	ExplorerTxPath string   `yaml:"explorer_tx_path"`
+	NativeSymbol   string   `yaml:"native_symbol"`
+	Token          string   `yaml:"token"`
+}
+
+// Networks maps lower case network names to networks.
+type Networks map[string]Network
+
+// Lookup returns the network called name, ignoring case.
+func (n Networks) Lookup(name string) (Network, bool) {
+	network, ok := n[strings.ToLower(name)]
+	return network, ok
+}
+
+// LoadNetworks returns the networks bundled with the faucet merged with the
+// network registry file at path, a YAML or JSON list of networks. A network of
+// the file replaces the bundled network of the same name. An empty path only
+// loads the bundled networks.
+func LoadNetworks(path string) (Networks, error) {
+	networks := make(Networks)
+	if err := networks.add(bundledNetworks, "bundled"); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return networks, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := networks.add(content, path); err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+func (n Networks) add(content []byte, source string) error {
+	var entries []Network
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return fmt.Errorf("failed to parse network registry %s: %w", source, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("network registry %s is empty", source)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for _, network := range entries {
+		if err := validateNetwork(network); err != nil {
+			return fmt.Errorf("network registry %s: %w", source, err)
+		}
+		key := strings.ToLower(network.Name)
+		if seen[key] {
+			return fmt.Errorf("network registry %s: duplicate network %s", source, network.Name)
+		}
+		seen[key] = true
+		n[key] = network
+	}
+	return nil
+}
+
+func validateNetwork(network Network) error {
+	switch {
+	case network.Name == "":
+		return errors.New("network with missing name")
+	case network.ChainID == 0:
+		return fmt.Errorf("network %s: missing chain id", network.Name)
+	case network.Token != "" && !chain.IsValidAddress(network.Token, false):
+		return fmt.Errorf("network %s: invalid token address %q", network.Name, network.Token)
+	}
+	for _, rpcURL := range network.RPCURLs {
+		if !hasScheme(rpcURL, "http", "https", "ws", "wss") {
+			return fmt.Errorf("network %s: invalid rpc url %q", network.Name, rpcURL)
+		}
+	}
+	if network.ExplorerURL != "" && !hasScheme(network.ExplorerURL, "http", "https") {
+		return fmt.Errorf("network %s: invalid explorer url %q", network.Name, network.ExplorerURL)
+	}
+	return nil
+}
+
+func hasScheme(rawURL string, schemes ...string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
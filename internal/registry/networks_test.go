@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadNetworks(t *testing.T) {
+	sepolia := Network{
+		Name:           "lisk_sepolia",
+		ChainID:        4202,
+		RPCURLs:        []string{"https://rpc.sepolia-api.lisk.com"},
+		ExplorerURL:    "https://sepolia-blockscout.lisk.com",
+		ExplorerTxPath: "tx",
+		NativeSymbol:   "ETH",
+		Token:          "0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D",
+	}
+	override := sepolia
+	override.RPCURLs = []string{"https://rpc.sepolia-api.lisk.com", "wss://ws.sepolia-api.lisk.com"}
+	testfork := Network{
+		Name:           "Lisk_Mainnet_Testfork",
+		ChainID:        1135,
+		RPCURLs:        []string{"http://localhost:8545"},
+		ExplorerURL:    "http://localhost:4000",
+		ExplorerTxPath: "tx",
+		NativeSymbol:   "ETH",
+	}
+	tests := []struct {
+		name    string
+		path    string
+		want    Networks
+		wantErr bool
+	}{
+		{name: "bundled", want: Networks{"lisk_sepolia": sepolia}},
+		{name: "merged", path: "testdata/networks.yaml", want: Networks{"lisk_sepolia": override, "lisk_mainnet_testfork": testfork}},
+		{name: "invalid", path: "testdata/networks_invalid.yaml", wantErr: true},
+		{name: "notfound", path: "testdata/null.yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadNetworks(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadNetworks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadNetworks() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworksLookup(t *testing.T) {
+	networks, err := LoadNetworks("testdata/networks.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network, ok := networks.Lookup("lisk_mainnet_testfork"); !ok || network.ChainID != 1135 {
+		t.Errorf("Lookup() got = %v, %v, want chain id 1135", network, ok)
+	}
+	if _, ok := networks.Lookup("devnet"); ok {
+		t.Error("Lookup() found unknown network")
+	}
+}
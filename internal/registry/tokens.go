@@ -0,0 +1,376 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+)
+
+// DecimalsUnset marks a token whose decimals are not configured and are read
+// from the contract instead.
+const DecimalsUnset = -1
+
+// IntervalUnset marks a token whose claim interval is not configured and is
+// taken from the default interval of the faucet instead. A zero interval
+// disables the rate limit, so an omitted interval must not become zero.
+const IntervalUnset = -1
+
+// Payout modes of a token. Transferred tokens are paid out of the faucet
+// account's balance, minted tokens are minted to the recipient.
+const (
+	ModeTransfer = "transfer"
+	ModeMint     = "mint"
+)
+
+// Token describes an ERC20 token served by the faucet. An empty Symbol or
+// DecimalsUnset means the value is taken from the contract. Payout is the
+// exact decimal amount of tokens sent per claim, such as "0.1". Recipients
+// holding more than MaxBalance are refused, an empty MaxBalance disables the
+// check. In TopUp mode the payout is a target balance and only the difference
+// to the recipient's balance is sent. Tiers scale the payout down as the
+// faucet reserve drops, and claims pause while the reserve is below Floor.
+// HourlyBudget and DailyBudget cap the amount paid out by all claims of the
+// token within an hour or a day. An alert fires while the faucet holds less
+// than AlertBelow. RefillAmount tokens are pulled from the treasury whenever
+// the faucet holds less than RefillBelow. Mode is ModeTransfer or ModeMint,
+// empty means ModeTransfer.
+type Token struct {
+	Symbol       string
+	Name         string
+	Address      string
+	Decimals     int
+	Payout       string
+	Interval     int
+	MaxBalance   string
+	TopUp        bool
+	Tiers        []Tier
+	Floor        string
+	HourlyBudget string
+	DailyBudget  string
+	AlertBelow   string
+	RefillBelow  string
+	RefillAmount string
+	Mode         string
+}
+
+// Tier scales the payout by Scale, a decimal fraction such as "0.5", while
+// the faucet reserve is below the decimal token amount Below.
+type Tier struct {
+	Below string `yaml:"below"`
+	Scale string `yaml:"scale"`
+}
+
+// scaleDecimals is the precision of tier scales.
+const scaleDecimals = 18
+
+var scaleOne = new(big.Int).Exp(big.NewInt(10), big.NewInt(scaleDecimals), nil)
+
+// Metadata is the token information exposed by the contract itself.
+type Metadata struct {
+	Name     string
+	Symbol   string
+	Decimals int
+}
+
+type tokenEntry struct {
+	Symbol       string `yaml:"symbol"`
+	Address      string `yaml:"address"`
+	Decimals     *int   `yaml:"decimals"`
+	Payout       string `yaml:"payout"`
+	Interval     *int   `yaml:"interval"`
+	MaxBalance   string `yaml:"max_balance"`
+	TopUp        bool   `yaml:"topup"`
+	Tiers        []Tier `yaml:"tiers"`
+	Floor        string `yaml:"floor"`
+	HourlyBudget string `yaml:"hourly_budget"`
+	DailyBudget  string `yaml:"daily_budget"`
+	AlertBelow   string `yaml:"alert_below"`
+	RefillBelow  string `yaml:"refill_below"`
+	RefillAmount string `yaml:"refill_amount"`
+	Mode         string `yaml:"mode"`
+}
+
+// LoadTokens reads a token registry file. The file is a YAML or JSON list of
+// tokens, each with a contract address, payout per claim and claim interval in
+// minutes. Symbol and decimals are optional and read from the contract when
+// omitted, see ApplyMetadata. An omitted interval is left IntervalUnset for
+// the caller to fill in with its default. The result must pass ValidateTokens
+// once the metadata is applied and the intervals are set.
+func LoadTokens(path string) ([]Token, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []tokenEntry
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse token registry %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("token registry %s is empty", path)
+	}
+
+	tokens := make([]Token, 0, len(entries))
+	for _, entry := range entries {
+		token := Token{
+			Symbol:       entry.Symbol,
+			Address:      entry.Address,
+			Decimals:     DecimalsUnset,
+			Payout:       entry.Payout,
+			Interval:     IntervalUnset,
+			MaxBalance:   entry.MaxBalance,
+			TopUp:        entry.TopUp,
+			Tiers:        entry.Tiers,
+			Floor:        entry.Floor,
+			HourlyBudget: entry.HourlyBudget,
+			DailyBudget:  entry.DailyBudget,
+			AlertBelow:   entry.AlertBelow,
+			RefillBelow:  entry.RefillBelow,
+			RefillAmount: entry.RefillAmount,
+			Mode:         entry.Mode,
+		}
+		if entry.Decimals != nil {
+			token.Decimals = *entry.Decimals
+		}
+		if entry.Interval != nil {
+			token.Interval = *entry.Interval
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// PayoutUnits returns the payout per claim in base units of the token.
+func (t Token) PayoutUnits() (*big.Int, error) {
+	return chain.ParseUnits(t.Payout, t.Decimals)
+}
+
+// MaxBalanceUnits returns the maximum balance of a recipient in base units of
+// the token, or nil when recipients are not checked.
+func (t Token) MaxBalanceUnits() (*big.Int, error) {
+	if t.MaxBalance == "" {
+		return nil, nil
+	}
+	return chain.ParseUnits(t.MaxBalance, t.Decimals)
+}
+
+// ScaledPayout returns the payout in base units of the token while the
+// faucet holds reserve, scaled by the tier with the lowest threshold above the
+// reserve. It reports false when claims are paused below the floor.
+func (t Token) ScaledPayout(reserve *big.Int) (*big.Int, bool, error) {
+	payout, err := t.PayoutUnits()
+	if err != nil {
+		return nil, false, err
+	}
+	floor, err := t.FloorUnits()
+	if err != nil {
+		return nil, false, err
+	}
+	if floor != nil && reserve.Cmp(floor) < 0 {
+		return payout, false, nil
+	}
+
+	var scale, lowest *big.Int
+	for _, tier := range t.Tiers {
+		below, err := chain.ParseUnits(tier.Below, t.Decimals)
+		if err != nil {
+			return nil, false, err
+		}
+		if reserve.Cmp(below) >= 0 || lowest != nil && below.Cmp(lowest) >= 0 {
+			continue
+		}
+		if scale, err = chain.ParseUnits(tier.Scale, scaleDecimals); err != nil {
+			return nil, false, err
+		}
+		lowest = below
+	}
+	if scale == nil {
+		return payout, true, nil
+	}
+	return new(big.Int).Div(new(big.Int).Mul(payout, scale), scaleOne), true, nil
+}
+
+// FloorUnits returns the reserve below which claims pause in base units of the
+// token, or nil when claims never pause.
+func (t Token) FloorUnits() (*big.Int, error) {
+	if t.Floor == "" {
+		return nil, nil
+	}
+	return chain.ParseUnits(t.Floor, t.Decimals)
+}
+
+// BudgetUnits returns the hourly and daily budgets in base units of the token,
+// nil for a window without budget.
+func (t Token) BudgetUnits() (hourly, daily *big.Int, err error) {
+	if t.HourlyBudget != "" {
+		if hourly, err = chain.ParseUnits(t.HourlyBudget, t.Decimals); err != nil {
+			return nil, nil, err
+		}
+	}
+	if t.DailyBudget != "" {
+		if daily, err = chain.ParseUnits(t.DailyBudget, t.Decimals); err != nil {
+			return nil, nil, err
+		}
+	}
+	return hourly, daily, nil
+}
+
+// AlertUnits returns the reserve below which an alert fires in base units of
+// the token, or nil when the reserve is not monitored.
+func (t Token) AlertUnits() (*big.Int, error) {
+	if t.AlertBelow == "" {
+		return nil, nil
+	}
+	return chain.ParseUnits(t.AlertBelow, t.Decimals)
+}
+
+// Minted reports whether claims mint the token instead of transferring it.
+func (t Token) Minted() bool {
+	return t.Mode == ModeMint
+}
+
+// RefillUnits returns the reserve below which the faucet is refilled and the
+// amount pulled from the treasury in base units of the token, both nil when
+// refills are disabled.
+func (t Token) RefillUnits() (below, amount *big.Int, err error) {
+	if t.RefillBelow == "" && t.RefillAmount == "" {
+		return nil, nil, nil
+	}
+	if t.RefillBelow == "" || t.RefillAmount == "" {
+		return nil, nil, errors.New("refill threshold and amount must be set together")
+	}
+	if below, err = chain.ParseUnits(t.RefillBelow, t.Decimals); err != nil {
+		return nil, nil, err
+	}
+	if amount, err = chain.ParseUnits(t.RefillAmount, t.Decimals); err != nil {
+		return nil, nil, err
+	}
+	if amount.Sign() <= 0 {
+		return nil, nil, errors.New("refill amount must be positive")
+	}
+	return below, amount, nil
+}
+
+// ParseTiers parses tiers written as comma separated below:scale pairs, such
+// as "1000:0.5,100:0.1".
+func ParseTiers(value string) ([]Tier, error) {
+	var tiers []Tier
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		below, scale, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tier %q, expected below:scale", pair)
+		}
+		tiers = append(tiers, Tier{Below: strings.TrimSpace(below), Scale: strings.TrimSpace(scale)})
+	}
+	return tiers, nil
+}
+
+// ApplyMetadata replaces the symbol, name and decimals of the token with the
+// values read from the contract. Configured values that disagree with the
+// contract are an error in strict mode and logged as a warning otherwise.
+func (t *Token) ApplyMetadata(meta Metadata, strict bool) error {
+	var mismatches []string
+	if t.Symbol != "" && t.Symbol != meta.Symbol {
+		mismatches = append(mismatches, fmt.Sprintf("symbol %q, contract has %q", t.Symbol, meta.Symbol))
+	}
+	if t.Decimals != DecimalsUnset && t.Decimals != meta.Decimals {
+		mismatches = append(mismatches, fmt.Sprintf("decimals %d, contract has %d", t.Decimals, meta.Decimals))
+	}
+	if len(mismatches) > 0 {
+		if strict {
+			return fmt.Errorf("token %s: configured %s", t.Address, strings.Join(mismatches, ", configured "))
+		}
+		for _, mismatch := range mismatches {
+			log.WithField("token", t.Address).Warnf("Configured %s, using the contract value", mismatch)
+		}
+	}
+
+	t.Symbol = meta.Symbol
+	t.Name = meta.Name
+	t.Decimals = meta.Decimals
+	return nil
+}
+
+// ValidateTokens checks that every token is usable and that symbols and
+// addresses are unique, since claims may refer to a token by either.
+func ValidateTokens(tokens []Token) error {
+	if len(tokens) == 0 {
+		return errors.New("no tokens configured")
+	}
+	seen := make(map[string]bool)
+	for i, token := range tokens {
+		switch {
+		case token.Symbol == "":
+			return fmt.Errorf("token %d: missing symbol", i)
+		case !chain.IsValidAddress(token.Address, false):
+			return fmt.Errorf("token %s: invalid address %q", token.Symbol, token.Address)
+		case token.Decimals < 0:
+			return fmt.Errorf("token %s: invalid decimals %d", token.Symbol, token.Decimals)
+		case token.Interval == IntervalUnset:
+			return fmt.Errorf("token %s: missing interval", token.Symbol)
+		case token.Interval < 0:
+			return fmt.Errorf("token %s: interval must not be negative", token.Symbol)
+		case token.Mode != "" && token.Mode != ModeTransfer && token.Mode != ModeMint:
+			return fmt.Errorf("token %s: unknown mode %q", token.Symbol, token.Mode)
+		case token.Minted() && (len(token.Tiers) > 0 || token.Floor != "" || token.RefillAmount != "" || token.AlertBelow != ""):
+			return fmt.Errorf("token %s: tiers, floor, refill and alert threshold depend on the faucet balance and do not apply to minted tokens", token.Symbol)
+		}
+		if payout, err := token.PayoutUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid payout: %w", token.Symbol, err)
+		} else if payout.Sign() <= 0 {
+			return fmt.Errorf("token %s: payout must be positive", token.Symbol)
+		}
+		if _, err := token.MaxBalanceUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid max balance: %w", token.Symbol, err)
+		}
+		if _, err := token.FloorUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid floor: %w", token.Symbol, err)
+		}
+		if _, _, err := token.BudgetUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid budget: %w", token.Symbol, err)
+		}
+		if _, err := token.AlertUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid alert threshold: %w", token.Symbol, err)
+		}
+		if _, _, err := token.RefillUnits(); err != nil {
+			return fmt.Errorf("token %s: invalid refill: %w", token.Symbol, err)
+		}
+		for _, tier := range token.Tiers {
+			if err := validateTier(tier, token.Decimals); err != nil {
+				return fmt.Errorf("token %s: invalid tier: %w", token.Symbol, err)
+			}
+		}
+		for _, key := range []string{strings.ToLower(token.Symbol), strings.ToLower(token.Address)} {
+			if seen[key] {
+				return fmt.Errorf("token %s: duplicate symbol or address", token.Symbol)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+func validateTier(tier Tier, decimals int) error {
+	if _, err := chain.ParseUnits(tier.Below, decimals); err != nil {
+		return err
+	}
+	scale, err := chain.ParseUnits(tier.Scale, scaleDecimals)
+	if err != nil {
+		return err
+	}
+	if scale.Sign() <= 0 || scale.Cmp(scaleOne) > 0 {
+		return fmt.Errorf("scale %s must be above 0 and at most 1", tier.Scale)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestLoadTokens(t *testing.T) {
+	want := []Token{
+		{Symbol: "LSK", Address: "0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D", Decimals: DecimalsUnset, Payout: "0.1", Interval: 10080, Tiers: []Tier{{Below: "1000", Scale: "0.5"}}, Floor: "10"},
+		{Symbol: "USDT", Address: "0x5A7BaF9bE8A4e8E5c4D5ec7fC7eD4A1e0C5d3F21", Decimals: 6, Payout: "50", Interval: 1440, MaxBalance: "500", TopUp: true, HourlyBudget: "5000", DailyBudget: "50000", Mode: ModeMint},
+	}
+	tests := []struct {
+		name    string
+		path    string
+		want    []Token
+		wantErr bool
+	}{
+		{name: "yaml", path: "testdata/tokens.yaml", want: want},
+		{name: "json", path: "testdata/tokens.json", want: want},
+		{name: "default interval", path: "testdata/default_interval.yaml", want: []Token{
+			{Symbol: "LSK", Address: "0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D", Decimals: DecimalsUnset, Payout: "1", Interval: IntervalUnset},
+		}},
+		{name: "notfound", path: "testdata/null.yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadTokens(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadTokens() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadTokens() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTokens(t *testing.T) {
+	valid := Token{Symbol: "LSK", Address: "0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D", Decimals: 18, Payout: "1"}
+	tests := []struct {
+		name    string
+		modify  func(token *Token)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*Token) {}},
+		{name: "missing symbol", modify: func(token *Token) { token.Symbol = "" }, wantErr: true},
+		{name: "invalid address", modify: func(token *Token) { token.Address = "0x1234" }, wantErr: true},
+		{name: "negative decimals", modify: func(token *Token) { token.Decimals = -1 }, wantErr: true},
+		{name: "zero payout", modify: func(token *Token) { token.Payout = "0" }, wantErr: true},
+		{name: "large payout", modify: func(token *Token) { token.Payout = "100000000000" }},
+		{name: "payout beyond decimals", modify: func(token *Token) { token.Payout = "0.0000001"; token.Decimals = 6 }, wantErr: true},
+		{name: "max balance", modify: func(token *Token) { token.MaxBalance = "10.5" }},
+		{name: "malformed max balance", modify: func(token *Token) { token.MaxBalance = "ten" }, wantErr: true},
+		{name: "tiers", modify: func(token *Token) { token.Tiers = []Tier{{Below: "1000", Scale: "0.5"}}; token.Floor = "10" }},
+		{name: "scale above one", modify: func(token *Token) { token.Tiers = []Tier{{Below: "1000", Scale: "1.5"}} }, wantErr: true},
+		{name: "zero scale", modify: func(token *Token) { token.Tiers = []Tier{{Below: "1000", Scale: "0"}} }, wantErr: true},
+		{name: "budgets", modify: func(token *Token) { token.HourlyBudget = "100"; token.DailyBudget = "1000.5" }},
+		{name: "malformed budget", modify: func(token *Token) { token.DailyBudget = "lots" }, wantErr: true},
+		{name: "alert threshold", modify: func(token *Token) { token.AlertBelow = "1000" }},
+		{name: "malformed alert threshold", modify: func(token *Token) { token.AlertBelow = "0x10" }, wantErr: true},
+		{name: "refill", modify: func(token *Token) { token.RefillBelow = "100"; token.RefillAmount = "1000" }},
+		{name: "refill without amount", modify: func(token *Token) { token.RefillBelow = "100" }, wantErr: true},
+		{name: "zero refill amount", modify: func(token *Token) { token.RefillBelow = "100"; token.RefillAmount = "0" }, wantErr: true},
+		{name: "mint mode", modify: func(token *Token) { token.Mode = ModeMint }},
+		{name: "unknown mode", modify: func(token *Token) { token.Mode = "burn" }, wantErr: true},
+		{name: "mint mode with floor", modify: func(token *Token) { token.Mode = ModeMint; token.Floor = "10" }, wantErr: true},
+		{name: "malformed floor", modify: func(token *Token) { token.Floor = "-1" }, wantErr: true},
+		{name: "malformed payout", modify: func(token *Token) { token.Payout = "1e18" }, wantErr: true},
+		{name: "missing interval", modify: func(token *Token) { token.Interval = IntervalUnset }, wantErr: true},
+		{name: "negative interval", modify: func(token *Token) { token.Interval = -2 }, wantErr: true},
+		{name: "zero interval", modify: func(token *Token) { token.Interval = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := valid
+			tt.modify(&token)
+			if err := ValidateTokens([]Token{token}); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTokens() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := ValidateTokens(nil); err == nil {
+		t.Errorf("ValidateTokens() expected error for empty registry")
+	}
+
+	duplicates, err := LoadTokens("testdata/duplicate.yaml")
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	for i := range duplicates {
+		duplicates[i].Decimals = 18
+	}
+	if err := ValidateTokens(duplicates); err == nil {
+		t.Errorf("ValidateTokens() expected error for duplicate symbols")
+	}
+}
+
+func TestToken_ApplyMetadata(t *testing.T) {
+	meta := Metadata{Name: "Lisk", Symbol: "LSK", Decimals: 18}
+	tests := []struct {
+		name    string
+		token   Token
+		strict  bool
+		wantErr bool
+	}{
+		{name: "unset", token: Token{Decimals: DecimalsUnset}},
+		{name: "matching", token: Token{Symbol: "LSK", Decimals: 18}, strict: true},
+		{name: "mismatch", token: Token{Symbol: "LSK", Decimals: 6}},
+		{name: "strict symbol mismatch", token: Token{Symbol: "ETH", Decimals: DecimalsUnset}, strict: true, wantErr: true},
+		{name: "strict decimals mismatch", token: Token{Decimals: 6}, strict: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			err := token.ApplyMetadata(meta, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ApplyMetadata() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (token.Symbol != meta.Symbol || token.Name != meta.Name || token.Decimals != meta.Decimals) {
+				t.Errorf("ApplyMetadata() got = %v, want metadata %v", token, meta)
+			}
+		})
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("1000:0.5, 100:0.1")
+	if err != nil {
+		t.Fatalf("ParseTiers() error = %v", err)
+	}
+	want := []Tier{{Below: "1000", Scale: "0.5"}, {Below: "100", Scale: "0.1"}}
+	if !reflect.DeepEqual(tiers, want) {
+		t.Errorf("ParseTiers() got = %v, want %v", tiers, want)
+	}
+	if tiers, err = ParseTiers(""); err != nil || len(tiers) != 0 {
+		t.Errorf("ParseTiers() got = %v, %v for empty value", tiers, err)
+	}
+	if _, err = ParseTiers("1000"); err == nil {
+		t.Errorf("ParseTiers() expected error for missing scale")
+	}
+}
+
+func TestToken_ScaledPayout(t *testing.T) {
+	token := Token{
+		Decimals: 2,
+		Payout:   "10",
+		Tiers:    []Tier{{Below: "100", Scale: "0.1"}, {Below: "1000", Scale: "0.5"}},
+		Floor:    "20",
+	}
+	tests := []struct {
+		name       string
+		reserve    int64
+		want       int64
+		wantPaused bool
+	}{
+		{name: "full reserve", reserve: 500000, want: 1000},
+		{name: "at tier threshold", reserve: 100000, want: 1000},
+		{name: "below first tier", reserve: 99999, want: 500},
+		{name: "below lowest tier", reserve: 5000, want: 100},
+		{name: "at floor", reserve: 2000, want: 100},
+		{name: "below floor", reserve: 1999, wantPaused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := token.ScaledPayout(big.NewInt(tt.reserve))
+			if err != nil {
+				t.Fatalf("ScaledPayout() error = %v", err)
+			}
+			if ok == tt.wantPaused {
+				t.Errorf("ScaledPayout() ok = %v, want paused %v", ok, tt.wantPaused)
+			}
+			if !tt.wantPaused && got.Int64() != tt.want {
+				t.Errorf("ScaledPayout() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
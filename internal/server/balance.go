@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
+// balanceError refuses the claim of a recipient that already holds more than
+// the faucet is willing to top up.
+type balanceError struct {
+	symbol  string
+	balance string
+	limit   string
+}
+
+func (e *balanceError) Error() string {
+	return fmt.Sprintf("Your balance of %s %s already reaches the faucet limit of %s %s", e.balance, e.symbol, e.limit, e.symbol)
+}
+
+// pausedError refuses claims of a token while the faucet reserve is below
+// its floor.
+type pausedError struct {
+	symbol string
+}
+
+func (e *pausedError) Error() string {
+	return fmt.Sprintf("The %s faucet is paused until it is refilled, please try again later", e.symbol)
+}
+
+// scalesPayout reports whether the payout of token depends on the faucet
+// reserve, because it scales the payout or pauses claims.
+func scalesPayout(token registry.Token) bool {
+	return len(token.Tiers) > 0 || token.Floor != ""
+}
+
+// tokenPayout returns the payout of token at the current faucet reserve, the
+// balance of all funding accounts. The reserve is only read when the token
+// scales its payout or pauses claims.
+func (s *Server) tokenPayout(ctx context.Context, token registry.Token) (*big.Int, error) {
+	if !scalesPayout(token) {
+		return token.PayoutUnits()
+	}
+
+	reserve := new(big.Int)
+	for _, account := range s.Accounts() {
+		balance, err := s.TokenBalance(ctx, common.HexToAddress(token.Address), account.Address)
+		if err != nil {
+			return nil, err
+		}
+		reserve.Add(reserve, balance)
+	}
+	return reservePayout(token, reserve)
+}
+
+// reservePayout returns the payout of token at the faucet reserve.
+func reservePayout(token registry.Token, reserve *big.Int) (*big.Int, error) {
+	payout, ok, err := token.ScaledPayout(reserve)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &pausedError{symbol: token.Symbol}
+	}
+	return payout, nil
+}
+
+// payoutAmount returns the amount to send to a recipient holding balance. It
+// reports false when the balance is above maxBalance or, in top-up mode, when
+// it already reaches the payout.
+func payoutAmount(balance, payout, maxBalance *big.Int, topUp bool) (*big.Int, bool) {
+	if maxBalance != nil && balance.Cmp(maxBalance) > 0 {
+		return nil, false
+	}
+	if !topUp {
+		return payout, true
+	}
+	amount := new(big.Int).Sub(payout, balance)
+	return amount, amount.Sign() > 0
+}
+
+// tokenAmount returns the amount of token to send to recipient, checking the
+// recipient balance only when the token limits it.
+func (s *Server) tokenAmount(ctx context.Context, token registry.Token, recipient common.Address) (*big.Int, error) {
+	payout, err := s.tokenPayout(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	maxBalance, err := token.MaxBalanceUnits()
+	if err != nil {
+		return nil, err
+	}
+	if maxBalance == nil && !token.TopUp {
+		return payout, nil
+	}
+
+	balance, err := s.TokenBalance(ctx, common.HexToAddress(token.Address), recipient)
+	if err != nil {
+		return nil, err
+	}
+	amount, ok := payoutAmount(balance, payout, maxBalance, token.TopUp)
+	if !ok {
+		return nil, &balanceError{
+			symbol:  token.Symbol,
+			balance: chain.FormatUnits(balance, token.Decimals),
+			limit:   limitAmount(payout, maxBalance, token.TopUp, token.Decimals),
+		}
+	}
+	return amount, nil
+}
+
+// nativeAmount returns the amount of native coins to send to recipient.
+func (s *Server) nativeAmount(ctx context.Context, recipient common.Address) (*big.Int, error) {
+	if s.cfg.nativeMaxBalance == nil && !s.cfg.nativeTopUp {
+		return s.cfg.nativePayout, nil
+	}
+
+	balance, err := s.BalanceAt(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	amount, ok := payoutAmount(balance, s.cfg.nativePayout, s.cfg.nativeMaxBalance, s.cfg.nativeTopUp)
+	if !ok {
+		return nil, &balanceError{
+			symbol:  s.cfg.nativeSymbol,
+			balance: chain.FormatUnits(balance, 18),
+			limit:   limitAmount(s.cfg.nativePayout, s.cfg.nativeMaxBalance, s.cfg.nativeTopUp, 18),
+		}
+	}
+	return amount, nil
+}
+
+// limitAmount formats the balance above which a recipient is refused, the
+// lower of the max balance and the top-up target.
+func limitAmount(payout, maxBalance *big.Int, topUp bool, decimals int) string {
+	limit := maxBalance
+	if topUp && (limit == nil || payout.Cmp(limit) < 0) {
+		limit = payout
+	}
+	return chain.FormatUnits(limit, decimals)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+func TestClaim_RecipientBalance(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBalance string
+		topUp      bool
+		balance    string
+		wantCode   int
+		wantAmount string
+	}{
+		{name: "below the limit", maxBalance: "5", balance: "1", wantCode: http.StatusAccepted, wantAmount: "1000000000000000000"},
+		{name: "above the limit", maxBalance: "5", balance: "6", wantCode: http.StatusForbidden},
+		{name: "top-up pays the difference", topUp: true, balance: "0.25", wantCode: http.StatusAccepted, wantAmount: "750000000000000000"},
+		{name: "top-up target reached", topUp: true, balance: "1", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakeBuilder()
+			balance, err := chain.ParseUnits(tt.balance, 18)
+			require.NoError(t, err)
+			builder.setBalance(builder.tokenBalances, firstRecipient, balance)
+			s := newTestServer(builder, store.NewMemoryStore())
+			s.cfg.tokens[0].MaxBalance = tt.maxBalance
+			s.cfg.tokens[0].TopUp = tt.topUp
+
+			rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+			require.Equal(t, tt.wantCode, rec.Code, resp.Message)
+			if tt.wantCode != http.StatusAccepted {
+				assert.Contains(t, resp.Message, "already reaches the faucet limit")
+				assert.False(t, limitReserved(t, s, firstRecipient))
+				assert.Zero(t, claimsUsed(t, s).Sign())
+				return
+			}
+			assert.Equal(t, tt.wantAmount, requireClaim(t, s, resp.ClaimID).Amount)
+		})
+	}
+}
+
+func TestClaim_ReservePayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		reserve    string
+		wantCode   int
+		wantAmount string
+	}{
+		{name: "full payout above the tiers", reserve: "500", wantCode: http.StatusAccepted, wantAmount: "1000000000000000000"},
+		{name: "scaled by the tier", reserve: "50", wantCode: http.StatusAccepted, wantAmount: "500000000000000000"},
+		{name: "scaled by the lowest tier", reserve: "5", wantCode: http.StatusAccepted, wantAmount: "100000000000000000"},
+		{name: "paused below the floor", reserve: "0.5", wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakeBuilder()
+			reserve, err := chain.ParseUnits(tt.reserve, 18)
+			require.NoError(t, err)
+			builder.setBalance(builder.tokenBalances, faucetAccount, reserve)
+			s := newTestServer(builder, store.NewMemoryStore())
+			s.cfg.tokens[0].Tiers = []registry.Tier{{Below: "100", Scale: "0.5"}, {Below: "10", Scale: "0.1"}}
+			s.cfg.tokens[0].Floor = "1"
+
+			rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+			require.Equal(t, tt.wantCode, rec.Code, resp.Message)
+			if tt.wantCode != http.StatusAccepted {
+				assert.Equal(t, "The LSK faucet is paused until it is refilled, please try again later", resp.Message)
+				assert.False(t, limitReserved(t, s, firstRecipient))
+				return
+			}
+			assert.Equal(t, tt.wantAmount, requireClaim(t, s, resp.ClaimID).Amount)
+		})
+	}
+}
+
+var secondAccount = common.HexToAddress("0x0000000000000000000000000000000000000Fa2")
+
+// pooledBuilder funds the faucet from two accounts.
+type pooledBuilder struct {
+	*fakeBuilder
+}
+
+func (b *pooledBuilder) Accounts() []chain.Account {
+	return []chain.Account{{Address: faucetAccount}, {Address: secondAccount}}
+}
+
+func TestClaim_ReserveOfAllAccounts(t *testing.T) {
+	builder := newFakeBuilder()
+	s := newTestServer(&pooledBuilder{fakeBuilder: builder}, store.NewMemoryStore())
+	s.cfg.tokens[0].Floor = "1"
+	half, err := chain.ParseUnits("0.5", 18)
+	require.NoError(t, err)
+	builder.setBalance(builder.tokenBalances, faucetAccount, half)
+	builder.setBalance(builder.tokenBalances, secondAccount, half)
+
+	// Neither account reaches the floor, but together they do
+	rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+	assert.Equal(t, http.StatusAccepted, rec.Code, resp.Message)
+}
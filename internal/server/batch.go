@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+// batchFlush asks the batcher to send the batch of an asset once its window
+// is over, unless the batch was already sent because it was full.
+type batchFlush struct {
+	asset      string
+	generation int
+}
+
+// batchable reports whether a payout may be sent along with others through
+// the disperse contract. Minted tokens are sent by the token contract itself.
+func (s *Server) batchable(p payout) bool {
+	return s.cfg.batchEnabled() && (p.token == nil || !p.token.Minted())
+}
+
+// asset returns the key of the batch a payout joins.
+func (p payout) asset() string {
+	if p.token == nil {
+		return claimTypeNative
+	}
+	return strings.ToLower(p.token.Address)
+}
+
+// runBatches collects the payouts handed over by the workers per asset and
+// sends them once the batch window is over or the batch is full.
+func (s *Server) runBatches(ctx context.Context) {
+	pending := make(map[string][]payout)
+	generations := make(map[string]int)
+	flushes := make(chan batchFlush)
+	send := func(asset string) {
+		batch := pending[asset]
+		delete(pending, asset)
+		generations[asset]++
+		go s.sendBatch(ctx, batch)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-s.batches:
+			asset := p.asset()
+			pending[asset] = append(pending[asset], p)
+			if len(pending[asset]) == 1 {
+				flush := batchFlush{asset: asset, generation: generations[asset]}
+				time.AfterFunc(s.cfg.batchWindow, func() {
+					select {
+					case flushes <- flush:
+					case <-ctx.Done():
+					}
+				})
+			}
+			if len(pending[asset]) >= s.cfg.batchSize {
+				send(asset)
+			}
+		case flush := <-flushes:
+			if flush.generation == generations[flush.asset] && len(pending[flush.asset]) > 0 {
+				send(flush.asset)
+			}
+		}
+	}
+}
+
+// sendBatch pays out a batch of payouts of the same asset in one transaction
+// through the disperse contract. When the batch fails before it is broadcast,
+// e.g. because its simulation reverts, every payout is sent on its own
+// instead. A batch that was signed may have been broadcast despite the error,
+// so its claims follow the signed transaction rather than pay out twice.
+func (s *Server) sendBatch(ctx context.Context, batch []payout) {
+	if len(batch) == 1 {
+		s.sendPayout(ctx, batch[0])
+		return
+	}
+
+	recipients := make([]common.Address, len(batch))
+	values := make([]*big.Int, len(batch))
+	for i, p := range batch {
+		recipients[i] = common.HexToAddress(p.claim.Address)
+		values[i] = p.amount
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, claimTimeout)
+	defer cancel()
+	sendCtx = chain.WithSignedHook(sendCtx, func(hash common.Hash) {
+		for _, p := range batch {
+			s.publishSigned(p.claim, hash)
+		}
+	})
+
+	token := batch[0].token
+	var txHash common.Hash
+	var err error
+	if token == nil {
+		txHash, err = s.DisperseETH(sendCtx, s.cfg.batchContract, recipients, values)
+	} else {
+		txHash, err = s.DisperseERC20(sendCtx, s.cfg.batchContract, common.HexToAddress(token.Address), recipients, values)
+	}
+	var broadcastErr *chain.BroadcastError
+	switch {
+	case errors.As(err, &broadcastErr):
+		// The receipt watcher reports the batch as dropped if it never reached the node
+		log.WithError(err).WithFields(log.Fields{"txHash": broadcastErr.Hash, "claims": len(batch)}).Warn("failed to broadcast batch, following its signed transaction")
+		txHash = broadcastErr.Hash
+		s.WatchTransaction(txHash)
+	case err != nil:
+		log.WithError(err).WithField("claims", len(batch)).Warn("failed to send batch, sending its claims one by one")
+		for _, p := range batch {
+			s.sendPayout(ctx, p)
+		}
+		return
+	}
+
+	fields := log.Fields{"txHash": txHash, "claims": len(batch)}
+	if token != nil {
+		fields["token"] = token.Symbol
+	}
+	log.WithFields(fields).Info("Batch sent successfully")
+	for _, p := range batch {
+		s.claimSent(ctx, p, txHash, true)
+	}
+}
+
+// resendBatched sends the payout of a claim on its own after the batch
+// transaction carrying it reverted. The claim keeps the budget charges
+// counted when it was queued.
+func (s *Server) resendBatched(claim store.Claim, reason string) {
+	log.WithFields(log.Fields{
+		"claim":  claim.ID,
+		"txHash": claim.TxHash,
+		"reason": reason,
+	}).Warn("batch transaction failed, sending claim on its own")
+
+	claim.Status, claim.TxHash, claim.BlockNumber, claim.Batched = store.ClaimSending, "", 0, false
+	p, err := s.claimPayout(claim)
+	if err != nil {
+		s.failClaim(claim, err)
+		return
+	}
+	s.saveClaim(p.claim)
+	s.sendPayout(context.Background(), p)
+}
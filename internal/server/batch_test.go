@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+var testDisperseAddress = common.HexToAddress("0x000000000000000000000000000000000000D15e")
+
+// batchBuilder sends batches through the disperse contract, or fails them
+// with err when it is set.
+type batchBuilder struct {
+	*fakeBuilder
+	batches [][]common.Address
+	err     error
+}
+
+func (b *batchBuilder) DisperseERC20(_ context.Context, _, _ common.Address, recipients []common.Address, _ []*big.Int) (common.Hash, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.err != nil {
+		return common.Hash{}, b.err
+	}
+	b.batches = append(b.batches, recipients)
+	hash := common.BigToHash(big.NewInt(int64(1000 + len(b.batches))))
+	b.states[hash] = chain.TxState{Hash: hash, Status: chain.TxPending}
+	return hash, nil
+}
+
+// queueBatch queues a claim of every recipient and returns the payouts the
+// workers hand to the batcher.
+func queueBatch(t *testing.T, s *Server, recipients ...common.Address) []payout {
+	var batch []payout
+	for i, recipient := range recipients {
+		rec, _ := postClaim(t, s, recipient, fmt.Sprintf("192.0.2.%d", i+1))
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		s.processClaim(context.Background(), <-s.queue.jobs)
+		batch = append(batch, <-s.batches)
+	}
+	return batch
+}
+
+func newTestBatchServer(builder chain.TxBuilder) *Server {
+	tokens := []registry.Token{{Symbol: "LSK", Address: testTokenAddress, Decimals: 18, Payout: "1", Interval: 60}}
+	cfg := NewConfig("testnet", tokens, 0, 0, "", "", "", "").
+		WithClaimBudgets(10, 0).
+		WithClaimQueue(1, 10).
+		WithBatching(testDisperseAddress, time.Second, 10)
+	s := NewServer(builder, store.NewMemoryStore(), cfg)
+	s.queue.jobs = make(chan string, cfg.queueSize)
+	s.batches = make(chan payout, cfg.queueSize)
+	return s
+}
+
+func TestBatch_Send(t *testing.T) {
+	builder := &batchBuilder{fakeBuilder: newFakeBuilder()}
+	s := newTestBatchServer(builder)
+	recorder := &alertRecorder{}
+	s.WithMonitor(NewMonitor(builder, s.cfg, recorder.notifier(t), time.Minute, nil, 1))
+	s.monitor.RecordClaim(errors.New("insufficient funds"))
+	require.Eventually(t, func() bool {
+		return len(recorder.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	batch := queueBatch(t, s, firstRecipient, secondRecipient)
+	s.sendBatch(context.Background(), batch)
+	require.Equal(t, [][]common.Address{{firstRecipient, secondRecipient}}, builder.batches)
+	assert.Empty(t, builder.sent())
+	var txHash common.Hash
+	for _, p := range batch {
+		claim := requireClaim(t, s, p.claim.ID)
+		assert.Equal(t, store.ClaimSent, claim.Status)
+		assert.True(t, claim.Batched)
+		txHash = common.HexToHash(claim.TxHash)
+	}
+
+	// Claims count as succeeded once the batch is confirmed, not when it is broadcast
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, recorder.received(), 1)
+	builder.finish(txHash, chain.TxConfirmed, 7, "")
+	for _, following := range s.queue.following() {
+		s.followClaim(following)
+	}
+	require.Eventually(t, func() bool {
+		return len(recorder.received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"firing " + claimFailuresAlert, "resolved " + claimFailuresAlert}, recorder.received())
+}
+
+func TestBatch_RevertSendsOneByOne(t *testing.T) {
+	builder := &batchBuilder{fakeBuilder: newFakeBuilder(), err: &chain.RevertError{Reason: "insufficient allowance"}}
+	s := newTestBatchServer(builder)
+
+	batch := queueBatch(t, s, firstRecipient, secondRecipient)
+	s.sendBatch(context.Background(), batch)
+	assert.Len(t, builder.sent(), 2)
+	for _, p := range batch {
+		claim := requireClaim(t, s, p.claim.ID)
+		assert.Equal(t, store.ClaimSent, claim.Status)
+		assert.False(t, claim.Batched)
+	}
+}
+
+func TestBatch_BroadcastFailure(t *testing.T) {
+	signed := common.HexToHash("0xba7c4")
+	builder := &batchBuilder{
+		fakeBuilder: newFakeBuilder(),
+		err:         &chain.BroadcastError{Hash: signed, Err: errors.New("context deadline exceeded")},
+	}
+	s := newTestBatchServer(builder)
+	recorder := &alertRecorder{}
+	s.WithMonitor(NewMonitor(builder, s.cfg, recorder.notifier(t), time.Minute, nil, 2))
+
+	// The batch may have reached the node, so its claims follow the signed transaction
+	batch := queueBatch(t, s, firstRecipient, secondRecipient)
+	s.sendBatch(context.Background(), batch)
+	assert.Empty(t, builder.sent())
+	_, watched := builder.TransactionState(signed)
+	assert.True(t, watched)
+	for _, p := range batch {
+		claim := requireClaim(t, s, p.claim.ID)
+		assert.Equal(t, store.ClaimSent, claim.Status)
+		assert.Equal(t, signed.Hex(), claim.TxHash)
+		assert.True(t, claim.Batched)
+	}
+
+	// A batch that never reached the node is dropped, its claims keep their rate limits
+	builder.finish(signed, chain.TxFailed, 0, "transaction dropped from mempool")
+	for _, following := range s.queue.following() {
+		s.followClaim(following)
+	}
+	for _, p := range batch {
+		assert.Equal(t, store.ClaimFailed, requireClaim(t, s, p.claim.ID).Status)
+	}
+	assert.Empty(t, builder.sent())
+	assert.True(t, limitReserved(t, s, firstRecipient))
+	require.Eventually(t, func() bool {
+		return len(recorder.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"firing " + claimFailuresAlert}, recorder.received())
+}
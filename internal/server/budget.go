@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+const claimsBudget = "claims"
+
+var budgetWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{name: "hourly", length: time.Hour},
+	{name: "daily", length: 24 * time.Hour},
+}
+
+// budgetError refuses a claim once a global budget is exhausted, until its
+// window resets.
+type budgetError struct {
+	window string
+	reset  time.Time
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("The faucet has reached its %s budget, please try again after %s", e.window, e.reset.UTC().Format(time.RFC1123))
+}
+
+// budget is a global limit on the claims or the amount of a token paid out
+// within a window.
+type budget struct {
+	name     string
+	window   string
+	length   time.Duration
+	limit    *big.Int
+	decimals int
+}
+
+func (b budget) key() string {
+	return "budget:" + b.name
+}
+
+// claimBudgets returns the budgets on the number of claims.
+func (s *Server) claimBudgets() []budget {
+	var budgets []budget
+	for i, limit := range []int{s.cfg.hourlyClaims, s.cfg.dailyClaims} {
+		if limit > 0 {
+			window := budgetWindows[i]
+			budgets = append(budgets, budget{name: claimsBudget, window: window.name, length: window.length, limit: big.NewInt(int64(limit))})
+		}
+	}
+	return budgets
+}
+
+// tokenBudgets returns the budgets on the amount of token paid out.
+func tokenBudgets(token registry.Token) ([]budget, error) {
+	hourly, daily, err := token.BudgetUnits()
+	if err != nil {
+		return nil, err
+	}
+	var budgets []budget
+	for i, limit := range []*big.Int{hourly, daily} {
+		if limit != nil {
+			window := budgetWindows[i]
+			budgets = append(budgets, budget{name: token.Symbol, window: window.name, length: window.length, limit: limit, decimals: token.Decimals})
+		}
+	}
+	return budgets, nil
+}
+
+// spendBudget counts a claim of amount against the global budgets, token is
+// nil for native coin claims which only count against the claim budgets. It
+// returns the charges to refund when the transfer fails, which remember their
+// window.
+func (s *Server) spendBudget(token *registry.Token, amount *big.Int) ([]store.Charge, error) {
+	budgets := s.claimBudgets()
+	if token != nil {
+		amountBudgets, err := tokenBudgets(*token)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, amountBudgets...)
+	}
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	charges := make([]store.Charge, len(budgets))
+	for i, b := range budgets {
+		charges[i] = store.Charge{Key: b.key(), Amount: big.NewInt(1), Limit: b.limit, Window: b.length, At: now}
+		if b.name != claimsBudget {
+			charges[i].Amount = amount
+		}
+	}
+	refused, reset, err := s.store.Spend(charges)
+	if err != nil {
+		return nil, err
+	}
+	if refused >= 0 {
+		return nil, &budgetError{window: budgets[refused].window, reset: reset}
+	}
+	return charges, nil
+}
+
+// refundBudget takes back the charges of a claim that was not paid out.
+func (s *Server) refundBudget(charges []store.Charge) {
+	if len(charges) == 0 {
+		return
+	}
+	refunds := make([]store.Charge, len(charges))
+	for i, charge := range charges {
+		refunds[i] = store.Charge{Key: charge.Key, Amount: new(big.Int).Neg(charge.Amount), Window: charge.Window, At: charge.At}
+	}
+	if _, _, err := s.store.Spend(refunds); err != nil {
+		log.WithError(err).Error("failed to refund budget of a failed claim")
+	}
+}
+
+// budgetInfos reports the usage of every configured budget.
+func (s *Server) budgetInfos() []budgetInfo {
+	budgets := s.claimBudgets()
+	for _, token := range s.cfg.tokens {
+		// The budgets were validated on startup
+		amountBudgets, _ := tokenBudgets(token)
+		budgets = append(budgets, amountBudgets...)
+	}
+
+	infos := make([]budgetInfo, 0, len(budgets))
+	for _, b := range budgets {
+		used, reset, err := s.store.Usage(b.key(), b.length)
+		if err != nil {
+			log.WithError(err).WithField("budget", b.key()).Warn("failed to read budget usage")
+			continue
+		}
+		info := budgetInfo{Name: b.name, Window: b.window, ResetAt: reset.UTC()}
+		if b.name == claimsBudget {
+			info.Used, info.Limit = used.String(), b.limit.String()
+		} else {
+			info.Used, info.Limit = chain.FormatUnits(used, b.decimals), chain.FormatUnits(b.limit, b.decimals)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func retryAfter(reset time.Time) string {
+	return strconv.Itoa(int(time.Until(reset).Seconds()) + 1)
+}
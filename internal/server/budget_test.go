@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+func TestClaim_TokenBudget(t *testing.T) {
+	s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+	s.cfg.WithClaimBudgets(0, 0)
+	s.cfg.tokens[0].HourlyBudget = "1.5"
+
+	rec, _ := postClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	rec, resp := postClaim(t, s, secondRecipient, "192.0.2.2")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, resp.Message, "hourly budget")
+	assert.False(t, limitReserved(t, s, secondRecipient))
+
+	retry, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.Positive(t, retry)
+	assert.LessOrEqual(t, time.Duration(retry)*time.Second, time.Hour+time.Second)
+
+	used, _, err := s.store.Usage(budget{name: "LSK"}.key(), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "1000000000000000000", used.String())
+}
@@ -1,31 +1,137 @@
 package server
 
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
 type Config struct {
-	network         string
-	symbol          string
-	payout          float64
-	tokenDecimals   int
-	httpPort        int
-	interval        int
-	proxyCount      int
-	hcaptchaSiteKey string
-	hcaptchaSecret  string
-	explorerURL     string
-	explorerTxPath  string
-}
-
-func NewConfig(network, symbol string, payout float64, tokenDecimals, httpPort, interval, proxyCount int, hcaptchaSiteKey, hcaptchaSecret, explorerURL, explorerTxPath string) *Config {
+	network          string
+	tokens           []registry.Token
+	httpPort         int
+	proxyCount       int
+	hcaptchaSiteKey  string
+	hcaptchaSecret   string
+	explorerURL      string
+	explorerTxPath   string
+	nativeSymbol     string
+	nativePayout     *big.Int
+	nativeInterval   int
+	nativeBundled    bool
+	nativeMaxBalance *big.Int
+	nativeTopUp      bool
+	hourlyClaims     int
+	dailyClaims      int
+	queueWorkers     int
+	queueSize        int
+	batchContract    common.Address
+	batchWindow      time.Duration
+	batchSize        int
+}
+
+func NewConfig(network string, tokens []registry.Token, httpPort, proxyCount int, hcaptchaSiteKey, hcaptchaSecret, explorerURL, explorerTxPath string) *Config {
 	return &Config{
 		network:         network,
-		symbol:          symbol,
+		tokens:          tokens,
 		httpPort:        httpPort,
-		interval:        interval,
-		payout:          payout,
-		tokenDecimals:   tokenDecimals,
 		proxyCount:      proxyCount,
 		hcaptchaSiteKey: hcaptchaSiteKey,
 		hcaptchaSecret:  hcaptchaSecret,
 		explorerURL:     explorerURL,
 		explorerTxPath:  explorerTxPath,
+		queueWorkers:    4,
+		queueSize:       1000,
+	}
+}
+
+// WithNativePayout enables claims of the native coin, the payout is given in
+// wei. A bundled payout is sent along with every token claim and shares its
+// rate limit, otherwise native claims are a separate claim type limited by
+// their own interval.
+func (c *Config) WithNativePayout(symbol string, payout *big.Int, interval int, bundled bool) *Config {
+	c.nativeSymbol = symbol
+	c.nativePayout = payout
+	c.nativeInterval = interval
+	c.nativeBundled = bundled
+	return c
+}
+
+// WithNativeBalanceLimit refuses native coin payouts to recipients holding
+// more than maxBalance wei, a nil maxBalance disables the check. In top-up
+// mode the native payout is a target balance and only the difference to the
+// recipient's balance is sent.
+func (c *Config) WithNativeBalanceLimit(maxBalance *big.Int, topUp bool) *Config {
+	c.nativeMaxBalance = maxBalance
+	c.nativeTopUp = topUp
+	return c
+}
+
+// WithClaimBudgets limits the number of claims of all users and tokens within
+// an hour and a day, zero disables a limit.
+func (c *Config) WithClaimBudgets(hourly, daily int) *Config {
+	c.hourlyClaims = hourly
+	c.dailyClaims = daily
+	return c
+}
+
+// WithClaimQueue sets the number of workers sending queued claims and the
+// number of claims that may wait in the queue before new claims are refused.
+func (c *Config) WithClaimQueue(workers, size int) *Config {
+	c.queueWorkers = max(workers, 1)
+	c.queueSize = max(size, 1)
+	return c
+}
+
+// WithBatching pays out queued claims of the same asset collected within
+// window in a single transaction through the disperse contract, at most size
+// claims at a time. A zero contract address disables batching.
+func (c *Config) WithBatching(contract common.Address, window time.Duration, size int) *Config {
+	c.batchContract = contract
+	c.batchWindow = window
+	c.batchSize = max(size, 1)
+	return c
+}
+
+func (c *Config) batchEnabled() bool {
+	return c.batchContract != (common.Address{})
+}
+
+func (c *Config) nativeEnabled() bool {
+	return c.nativePayout != nil && c.nativePayout.Sign() > 0
+}
+
+// token returns the token a claim asks for by symbol or contract address, or
+// the first token of the registry when the claim does not name one.
+func (c *Config) token(id string) (registry.Token, bool) {
+	if id == "" {
+		return c.tokens[0], true
+	}
+	for _, token := range c.tokens {
+		if strings.EqualFold(token.Symbol, id) || strings.EqualFold(token.Address, id) {
+			return token, true
+		}
+	}
+	return registry.Token{}, false
+}
+
+// claimLimit returns the namespace of the rate limit keys of a claim and the
+// interval between two such claims. Claims of the first token keep the plain
+// address and IP keys.
+func (c *Config) claimLimit(claim *claimRequest) (string, time.Duration) {
+	if claim.Type == claimTypeNative {
+		return claimTypeNative, time.Duration(c.nativeInterval) * time.Minute
+	}
+	token, ok := c.token(claim.Token)
+	if !ok {
+		return "", 0
+	}
+	if token.Address == c.tokens[0].Address {
+		return "", time.Duration(token.Interval) * time.Minute
 	}
+	return token.Symbol, time.Duration(token.Interval) * time.Minute
 }
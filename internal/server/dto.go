@@ -8,26 +8,123 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/LiskHQ/lsk-faucet/internal/chain"
 )
 
+const (
+	claimTypeToken  = "token"
+	claimTypeNative = "native"
+)
+
 type claimRequest struct {
 	Address string `json:"address"`
+	Type    string `json:"type,omitempty"`
+	Token   string `json:"token,omitempty"`
 }
 
 type claimResponse struct {
 	Message string `json:"msg"`
+	ClaimID string `json:"claim_id,omitempty"`
+}
+
+type queuedClaimResponse struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	Event        string    `json:"event"`
+	Type         string    `json:"type"`
+	Address      string    `json:"address"`
+	Token        string    `json:"token,omitempty"`
+	TxHash       string    `json:"txhash,omitempty"`
+	NativeTxHash string    `json:"native_txhash,omitempty"`
+	Amount       string    `json:"amount,omitempty"`
+	Batched      bool      `json:"batched,omitempty"`
+	BlockNumber  uint64    `json:"block_number,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type claimStatusResponse struct {
+	TxHash        string   `json:"txhash"`
+	Status        string   `json:"status"`
+	BlockNumber   uint64   `json:"block_number,omitempty"`
+	GasUsed       uint64   `json:"gas_used,omitempty"`
+	Confirmations uint64   `json:"confirmations,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	Replaced      []string `json:"replaced,omitempty"`
+}
+
+type tokenInfo struct {
+	Symbol               string `json:"symbol"`
+	Name                 string `json:"name,omitempty"`
+	Address              string `json:"address"`
+	Decimals             int    `json:"decimals"`
+	Payout               string `json:"payout"`
+	PayoutUnits          string `json:"payout_units"`
+	EffectivePayout      string `json:"effective_payout"`
+	EffectivePayoutUnits string `json:"effective_payout_units"`
+	Paused               bool   `json:"paused,omitempty"`
+	Interval             int    `json:"interval"`
+	MaxBalance           string `json:"max_balance,omitempty"`
+	TopUp                bool   `json:"topup,omitempty"`
+	Mode                 string `json:"mode"`
+}
+
+type accountInfo struct {
+	Address string `json:"address"`
+	Balance string `json:"balance,omitempty"`
+	Pending int    `json:"pending"`
+}
+
+type providerInfo struct {
+	URL         string     `json:"url"`
+	Healthy     bool       `json:"healthy"`
+	ChainID     string     `json:"chain_id,omitempty"`
+	WrongChain  bool       `json:"wrong_chain,omitempty"`
+	BlockNumber uint64     `json:"block_number"`
+	LatencyMs   int64      `json:"latency_ms"`
+	ErrorRate   float64    `json:"error_rate"`
+	Requests    uint64     `json:"requests"`
+	Failures    uint64     `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+}
+
+type budgetInfo struct {
+	Name    string    `json:"name"`
+	Window  string    `json:"window"`
+	Used    string    `json:"used"`
+	Limit   string    `json:"limit"`
+	ResetAt time.Time `json:"reset_at"`
 }
 
 type infoResponse struct {
-	Account         string `json:"account"`
-	Network         string `json:"network"`
-	Payout          string `json:"payout"`
-	Symbol          string `json:"symbol"`
-	HcaptchaSiteKey string `json:"hcaptcha_sitekey,omitempty"`
-	ExplorerURL     string `json:"explorer_url"`
-	ExplorerTxPath  string `json:"explorer_txPath"`
+	Account              string        `json:"account"`
+	Network              string        `json:"network"`
+	ChainID              string        `json:"chain_id"`
+	Payout               string        `json:"payout"`
+	PayoutUnits          string        `json:"payout_units"`
+	EffectivePayout      string        `json:"effective_payout"`
+	EffectivePayoutUnits string        `json:"effective_payout_units"`
+	Paused               bool          `json:"paused,omitempty"`
+	Symbol               string        `json:"symbol"`
+	TokenName            string        `json:"token_name,omitempty"`
+	TokenAddress         string        `json:"token_address"`
+	TokenDecimals        int           `json:"token_decimals"`
+	NativePayout         string        `json:"native_payout,omitempty"`
+	NativePayoutUnits    string        `json:"native_payout_units,omitempty"`
+	NativeSymbol         string        `json:"native_symbol,omitempty"`
+	NativeBundled        bool          `json:"native_bundled,omitempty"`
+	NativeMaxBalance     string        `json:"native_max_balance,omitempty"`
+	NativeTopUp          bool          `json:"native_topup,omitempty"`
+	HcaptchaSiteKey      string        `json:"hcaptcha_sitekey,omitempty"`
+	ExplorerURL          string        `json:"explorer_url"`
+	ExplorerTxPath       string        `json:"explorer_txPath"`
+	Accounts             []accountInfo `json:"accounts"`
+	Tokens               []tokenInfo   `json:"tokens"`
+	Budgets              []budgetInfo  `json:"budgets,omitempty"`
 }
 
 type malformedRequest struct {
@@ -82,16 +179,23 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 	return nil
 }
 
-func readAddress(r *http.Request) (string, error) {
+func readClaim(r *http.Request) (*claimRequest, error) {
 	var claimReq claimRequest
 	if err := decodeJSONBody(r, &claimReq); err != nil {
-		return "", err
+		return nil, err
 	}
 	if !chain.IsValidAddress(claimReq.Address, true) {
-		return "", &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
+		return nil, &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
+	}
+	switch claimReq.Type {
+	case "":
+		claimReq.Type = claimTypeToken
+	case claimTypeToken, claimTypeNative:
+	default:
+		return nil, &malformedRequest{status: http.StatusBadRequest, message: "invalid claim type"}
 	}
 
-	return claimReq.Address, nil
+	return &claimReq, nil
 }
 
 func renderJSON(w http.ResponseWriter, v interface{}, code int) error {
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+// Steps of a claim reported to the clients following it.
+const (
+	eventQueued    = "queued"
+	eventSigned    = "signed"
+	eventBroadcast = "broadcast"
+	eventMined     = "mined"
+	eventConfirmed = "confirmed"
+	eventFailed    = "failed"
+)
+
+// claimEventsHeartbeat is the interval of the comments that keep idle event
+// streams open through proxies.
+const claimEventsHeartbeat = 15 * time.Second
+
+// claimEvent returns the step a claim has reached.
+func claimEvent(claim store.Claim) string {
+	switch claim.Status {
+	case store.ClaimSending:
+		if claim.TxHash != "" {
+			return eventSigned
+		}
+		return eventQueued
+	case store.ClaimSent:
+		if claim.BlockNumber > 0 {
+			return eventMined
+		}
+		return eventBroadcast
+	case store.ClaimConfirmed:
+		return eventConfirmed
+	case store.ClaimFailed:
+		return eventFailed
+	default:
+		return eventQueued
+	}
+}
+
+// claimBroker passes the updates of claims to the event streams following
+// them. Updates are dropped for streams that fall behind, the streams also
+// read the claim from the store periodically and catch up from there.
+type claimBroker struct {
+	mutex       sync.Mutex
+	subscribers map[string]map[chan store.Claim]struct{}
+}
+
+func newClaimBroker() *claimBroker {
+	return &claimBroker{subscribers: make(map[string]map[chan store.Claim]struct{})}
+}
+
+func (b *claimBroker) subscribe(id string) (<-chan store.Claim, func()) {
+	updates := make(chan store.Claim, 8)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan store.Claim]struct{})
+	}
+	b.subscribers[id][updates] = struct{}{}
+
+	return updates, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.subscribers[id], updates)
+		if len(b.subscribers[id]) == 0 {
+			delete(b.subscribers, id)
+		}
+	}
+}
+
+func (b *claimBroker) publish(claim store.Claim) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for updates := range b.subscribers[claim.ID] {
+		select {
+		case updates <- claim:
+		default:
+		}
+	}
+}
+
+// handleClaimEvents streams the progress of a queued claim as Server-Sent
+// Events, one event per step named after the step and carrying the claim. The
+// stream starts with the current step and ends once the claim is confirmed or
+// failed.
+func (s *Server) handleClaimEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			renderJSON(w, claimResponse{Message: "streaming is not supported"}, http.StatusInternalServerError)
+			return
+		}
+		id := r.PathValue("id")
+		// Subscribe first, so no update between the read and the subscription is lost
+		updates, unsubscribe := s.events.subscribe(id)
+		defer unsubscribe()
+
+		claim, ok, err := s.store.Claim(id)
+		if err != nil {
+			log.WithError(err).Error("failed to read claim")
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			renderJSON(w, claimResponse{Message: "claim not found"}, http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		var last store.Claim
+		send := func(claim store.Claim) bool {
+			event := claimEvent(claim)
+			if last.ID != "" && (claim.UpdatedAt.Before(last.UpdatedAt) || event == claimEvent(last) && claim.TxHash == last.TxHash) {
+				return true
+			}
+			last = claim
+			data, err := json.Marshal(queuedClaimInfo(claim))
+			if err != nil {
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return event != eventConfirmed && event != eventFailed
+		}
+		if !send(claim) {
+			return
+		}
+
+		// Claims sent by another replica are only seen in the store
+		poll := time.NewTicker(claimFollowInterval)
+		defer poll.Stop()
+		heartbeat := time.NewTicker(claimEventsHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case claim := <-updates:
+				if !send(claim) {
+					return
+				}
+			case <-poll.C:
+				claim, ok, err := s.store.Claim(id)
+				if err != nil || !ok {
+					continue
+				}
+				if !send(claim) {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+type claimEventFrame struct {
+	event string
+	claim queuedClaimResponse
+}
+
+// openClaimEvents opens the event stream of a claim, the stream is closed
+// with the test.
+func openClaimEvents(t *testing.T, ctx context.Context, server *httptest.Server, id string) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/claims/"+id+"/events", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readClaimEvent returns the next event of a stream, or false once the
+// stream ended.
+func readClaimEvent(t *testing.T, reader *bufio.Reader) (claimEventFrame, bool) {
+	var frame claimEventFrame
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return frame, false
+		}
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && frame.event != "":
+			return frame, true
+		case strings.HasPrefix(line, "event: "):
+			frame.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame.claim))
+		}
+	}
+}
+
+func subscribers(s *Server) int {
+	s.events.mutex.Lock()
+	defer s.events.mutex.Unlock()
+	return len(s.events.subscribers)
+}
+
+func TestClaimEvents_Progress(t *testing.T) {
+	builder := newFakeBuilder()
+	s := newTestServer(builder, store.NewMemoryStore())
+	server := httptest.NewServer(s.setupRouter())
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+	events := openClaimEvents(t, ctx, server, resp.ClaimID)
+	require.Equal(t, http.StatusOK, events.StatusCode)
+	assert.Equal(t, "text/event-stream", events.Header.Get("Content-Type"))
+	reader := bufio.NewReader(events.Body)
+
+	// The stream starts with the current step of the claim
+	frame, ok := readClaimEvent(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, eventQueued, frame.event)
+	assert.Equal(t, resp.ClaimID, frame.claim.ID)
+
+	// A transaction signed again with the same hash is reported once
+	builder.onSend = func(hash common.Hash) {
+		claim := requireClaim(t, s, resp.ClaimID)
+		s.publishSigned(claim, hash)
+		s.publishSigned(claim, hash)
+	}
+	s.processClaim(ctx, <-s.queue.jobs)
+	txHash := common.HexToHash(requireClaim(t, s, resp.ClaimID).TxHash)
+
+	builder.finish(txHash, chain.TxPending, 7, "")
+	s.followClaim(requireClaim(t, s, resp.ClaimID))
+	builder.finish(txHash, chain.TxConfirmed, 7, "")
+	s.followClaim(requireClaim(t, s, resp.ClaimID))
+
+	var steps []string
+	for {
+		frame, ok := readClaimEvent(t, reader)
+		if !ok {
+			break
+		}
+		steps = append(steps, frame.event)
+		assert.Equal(t, txHash.Hex(), frame.claim.TxHash)
+	}
+	assert.Equal(t, []string{eventSigned, eventBroadcast, eventMined, eventConfirmed}, steps)
+}
+
+func TestClaimEvents_Finished(t *testing.T) {
+	for _, status := range []store.ClaimStatus{store.ClaimConfirmed, store.ClaimFailed} {
+		t.Run(string(status), func(t *testing.T) {
+			s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+			server := httptest.NewServer(s.setupRouter())
+			defer server.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			_, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+			claim := requireClaim(t, s, resp.ClaimID)
+			claim.Status = status
+			s.saveClaim(claim)
+
+			// A finished claim is reported once and the stream ends
+			reader := bufio.NewReader(openClaimEvents(t, ctx, server, resp.ClaimID).Body)
+			frame, ok := readClaimEvent(t, reader)
+			require.True(t, ok)
+			assert.Equal(t, claimEvent(claim), frame.event)
+			_, ok = readClaimEvent(t, reader)
+			assert.False(t, ok)
+			assert.Zero(t, subscribers(s))
+		})
+	}
+}
+
+func TestClaimEvents_UnknownClaim(t *testing.T) {
+	s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+	server := httptest.NewServer(s.setupRouter())
+	defer server.Close()
+
+	events := openClaimEvents(t, context.Background(), server, "unknown")
+	assert.Equal(t, http.StatusNotFound, events.StatusCode)
+	assert.Zero(t, subscribers(s))
+}
+
+func TestClaimEvents_Disconnect(t *testing.T) {
+	s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+	server := httptest.NewServer(s.setupRouter())
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+	reader := bufio.NewReader(openClaimEvents(t, ctx, server, resp.ClaimID).Body)
+	_, ok := readClaimEvent(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, 1, subscribers(s))
+
+	cancel()
+	assert.Eventually(t, func() bool { return subscribers(s) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+// Indexer seeds the rate limits from the Transfer events sent or minted by the
+// faucet account, so recent claimants keep their cooldown when the store was
+// lost or never saw their claim. Native coin claims emit no events and are not indexed.
+type Indexer struct {
+	builder  chain.TxBuilder
+	store    store.Store
+	cfg      *Config
+	window   uint64
+	interval time.Duration
+	indexed  bool
+	next     uint64
+}
+
+// NewIndexer creates an indexer that scans the last window blocks on its
+// first run and the blocks mined since the previous run every interval.
+func NewIndexer(builder chain.TxBuilder, store store.Store, cfg *Config, window uint64, interval time.Duration) *Indexer {
+	return &Indexer{
+		builder:  builder,
+		store:    store,
+		cfg:      cfg,
+		window:   window,
+		interval: interval,
+	}
+}
+
+// Run indexes the claim history once and then periodically until the context
+// is canceled. A zero interval indexes only once.
+func (i *Indexer) Run(ctx context.Context) {
+	if err := i.index(ctx); err != nil {
+		log.WithError(err).Error("failed to index claim history")
+	}
+	if i.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.index(ctx); err != nil {
+				log.WithError(err).Warn("failed to index claim history")
+			}
+		}
+	}
+}
+
+func (i *Indexer) index(ctx context.Context) error {
+	head, err := i.builder.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	from := i.next
+	if !i.indexed && head >= i.window {
+		from = head - i.window + 1
+	}
+	if from > head {
+		return nil
+	}
+
+	seeded := 0
+	for _, token := range i.cfg.tokens {
+		namespace, ttl := i.cfg.claimLimit(&claimRequest{Type: claimTypeToken, Token: token.Address})
+		if ttl <= 0 {
+			continue
+		}
+		transfers, err := i.transfers(ctx, token, from, head)
+		if err != nil {
+			return err
+		}
+
+		// Transfers are in block order, the last one of a recipient wins
+		lastClaims := make(map[common.Address]time.Time)
+		for _, transfer := range transfers {
+			lastClaims[transfer.To] = transfer.Time
+		}
+		for recipient, claimedAt := range lastClaims {
+			remaining := ttl - time.Since(claimedAt)
+			if remaining <= 0 {
+				continue
+			}
+			_, ok, err := i.store.Reserve([]string{limitKey(namespace, recipient.Hex())}, remaining)
+			if err != nil {
+				return err
+			}
+			if ok {
+				seeded++
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"fromBlock": from,
+		"toBlock":   head,
+		"seeded":    seeded,
+	}).Info("Indexed claim history")
+	i.indexed = true
+	i.next = head + 1
+	return nil
+}
+
+// transfers returns the payouts of token between fromBlock and toBlock, the
+// mints of tokens in mint mode and the faucet's transfers otherwise. Batched
+// transfers are sent by the disperse contract, so its transfers are included
+// when batching is enabled.
+func (i *Indexer) transfers(ctx context.Context, token registry.Token, fromBlock, toBlock uint64) ([]chain.Transfer, error) {
+	if token.Minted() {
+		return i.builder.MintedTransfers(ctx, common.HexToAddress(token.Address), fromBlock, toBlock)
+	}
+	var relays []common.Address
+	if i.cfg.batchEnabled() {
+		relays = append(relays, i.cfg.batchContract)
+	}
+	return i.builder.SentTransfers(ctx, common.HexToAddress(token.Address), fromBlock, toBlock, relays...)
+}
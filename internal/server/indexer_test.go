@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+const testMintedTokenAddress = "0x0000000000000000000000000000000000000bEE"
+
+type blockRange struct {
+	from, to uint64
+}
+
+// historyBuilder serves the transfers of the test from a fixed chain head
+// and records the block ranges scanned, every other chain call panics.
+type historyBuilder struct {
+	chain.TxBuilder
+	head    uint64
+	sent    map[common.Address][]chain.Transfer
+	minted  map[common.Address][]chain.Transfer
+	scanned []blockRange
+}
+
+func (b *historyBuilder) BlockNumber(context.Context) (uint64, error) {
+	return b.head, nil
+}
+
+func (b *historyBuilder) SentTransfers(_ context.Context, token common.Address, fromBlock, toBlock uint64, _ ...common.Address) ([]chain.Transfer, error) {
+	b.scanned = append(b.scanned, blockRange{from: fromBlock, to: toBlock})
+	return inRange(b.sent[token], fromBlock, toBlock), nil
+}
+
+func (b *historyBuilder) MintedTransfers(_ context.Context, token common.Address, fromBlock, toBlock uint64) ([]chain.Transfer, error) {
+	b.scanned = append(b.scanned, blockRange{from: fromBlock, to: toBlock})
+	return inRange(b.minted[token], fromBlock, toBlock), nil
+}
+
+func inRange(transfers []chain.Transfer, fromBlock, toBlock uint64) []chain.Transfer {
+	var found []chain.Transfer
+	for _, transfer := range transfers {
+		if transfer.BlockNumber >= fromBlock && transfer.BlockNumber <= toBlock {
+			found = append(found, transfer)
+		}
+	}
+	return found
+}
+
+// remainingLimit returns the remaining ttl of a rate limit key, or zero when
+// the key is free. A free key is reserved by the check.
+func remainingLimit(t *testing.T, limitStore store.Store, key string) time.Duration {
+	ttl, ok, err := limitStore.Reserve([]string{key}, time.Hour)
+	require.NoError(t, err)
+	if ok {
+		return 0
+	}
+	return ttl
+}
+
+func newTestIndexerConfig() *Config {
+	return NewConfig("testnet", []registry.Token{
+		{Symbol: "LSK", Address: testTokenAddress, Decimals: 18, Payout: "1", Interval: 60},
+		{Symbol: "MNT", Address: testMintedTokenAddress, Decimals: 18, Payout: "1", Interval: 120, Mode: registry.ModeMint},
+	}, 0, 0, "", "", "", "")
+}
+
+func TestIndexer_SeedsRecentClaims(t *testing.T) {
+	now := time.Now()
+	recent := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	expired := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	repeated := common.HexToAddress("0x0000000000000000000000000000000000000003")
+	minter := common.HexToAddress("0x0000000000000000000000000000000000000004")
+	builder := &historyBuilder{
+		head: 100,
+		sent: map[common.Address][]chain.Transfer{
+			common.HexToAddress(testTokenAddress): {
+				{To: repeated, BlockNumber: 10, Time: now.Add(-50 * time.Minute)},
+				{To: expired, BlockNumber: 20, Time: now.Add(-2 * time.Hour)},
+				{To: recent, BlockNumber: 30, Time: now.Add(-10 * time.Minute)},
+				{To: repeated, BlockNumber: 40, Time: now.Add(-20 * time.Minute)},
+			},
+		},
+		minted: map[common.Address][]chain.Transfer{
+			common.HexToAddress(testMintedTokenAddress): {
+				{To: minter, BlockNumber: 50, Time: now.Add(-30 * time.Minute)},
+			},
+		},
+	}
+	limitStore := store.NewMemoryStore()
+	indexer := NewIndexer(builder, limitStore, newTestIndexerConfig(), 1000, 0)
+	require.NoError(t, indexer.index(context.Background()))
+
+	// The first token keeps the plain address keys, others are namespaced
+	assert.InDelta(t, 50*time.Minute, remainingLimit(t, limitStore, recent.Hex()), float64(time.Minute))
+	assert.InDelta(t, 40*time.Minute, remainingLimit(t, limitStore, repeated.Hex()), float64(time.Minute))
+	assert.Zero(t, remainingLimit(t, limitStore, expired.Hex()))
+	assert.InDelta(t, 90*time.Minute, remainingLimit(t, limitStore, limitKey("MNT", minter.Hex())), float64(time.Minute))
+	assert.Zero(t, remainingLimit(t, limitStore, minter.Hex()))
+}
+
+func TestIndexer_KeepsExistingLimits(t *testing.T) {
+	recipient := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	builder := &historyBuilder{
+		head: 100,
+		sent: map[common.Address][]chain.Transfer{
+			common.HexToAddress(testTokenAddress): {
+				{To: recipient, BlockNumber: 10, Time: time.Now().Add(-50 * time.Minute)},
+			},
+		},
+	}
+	limitStore := store.NewMemoryStore()
+	_, ok, err := limitStore.Reserve([]string{recipient.Hex()}, 30*time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	indexer := NewIndexer(builder, limitStore, newTestIndexerConfig(), 1000, 0)
+	require.NoError(t, indexer.index(context.Background()))
+	assert.InDelta(t, 30*time.Minute, remainingLimit(t, limitStore, recipient.Hex()), float64(time.Minute))
+}
+
+func TestIndexer_BlockWindow(t *testing.T) {
+	builder := &historyBuilder{head: 1000}
+	indexer := NewIndexer(builder, store.NewMemoryStore(), newTestIndexerConfig(), 100, 0)
+	ctx := context.Background()
+
+	// The first run scans the window, later runs the blocks mined since
+	require.NoError(t, indexer.index(ctx))
+	assert.Equal(t, []blockRange{{901, 1000}, {901, 1000}}, builder.scanned)
+
+	builder.scanned = nil
+	builder.head = 1010
+	require.NoError(t, indexer.index(ctx))
+	assert.Equal(t, []blockRange{{1001, 1010}, {1001, 1010}}, builder.scanned)
+
+	builder.scanned = nil
+	require.NoError(t, indexer.index(ctx))
+	assert.Empty(t, builder.scanned)
+}
+
+func TestIndexer_ShortChain(t *testing.T) {
+	builder := &historyBuilder{head: 50}
+	indexer := NewIndexer(builder, store.NewMemoryStore(), newTestIndexerConfig(), 100, 0)
+
+	require.NoError(t, indexer.index(context.Background()))
+	assert.Equal(t, []blockRange{{0, 50}, {0, 50}}, builder.scanned)
+}
@@ -1,39 +1,45 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/jellydator/ttlcache/v2"
 	"github.com/kataras/hcaptcha"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
+
+	"github.com/LiskHQ/lsk-faucet/internal/store"
 )
 
+// limitFunc returns the namespace of the rate limit keys of a claim and the
+// interval between two such claims. A zero interval disables the limit.
+type limitFunc func(claim *claimRequest) (string, time.Duration)
+
+// Limiter rate limits claims by address and client IP. Every claim type and
+// token has its own interval and its own set of keys. The reserved keys are
+// released when the claim is refused, and are passed on in the request
+// context, see limitKeys, so a queued claim can release them when it fails.
 type Limiter struct {
-	mutex      sync.Mutex
-	cache      *ttlcache.Cache
+	store      store.Store
 	proxyCount int
-	ttl        time.Duration
+	limit      limitFunc
 }
 
-func NewLimiter(proxyCount int, ttl time.Duration) *Limiter {
-	cache := ttlcache.NewCache()
-	cache.SkipTTLExtensionOnHit(true)
+func NewLimiter(store store.Store, proxyCount int, limit limitFunc) *Limiter {
 	return &Limiter{
-		cache:      cache,
+		store:      store,
 		proxyCount: proxyCount,
-		ttl:        ttl,
+		limit:      limit,
 	}
 }
 
 func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	address, err := readAddress(r)
+	claim, err := readClaim(r)
 	if err != nil {
 		var mr *malformedRequest
 		if errors.As(err, &mr) {
@@ -44,40 +50,59 @@ func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.Ha
 		return
 	}
 
-	if l.ttl <= 0 {
+	namespace, ttl := l.limit(claim)
+	if ttl <= 0 {
 		next.ServeHTTP(w, r)
 		return
 	}
 
 	clintIP := getClientIPFromRequest(l.proxyCount, r)
-	l.mutex.Lock()
-	if l.limitByKey(w, address) || l.limitByKey(w, clintIP) {
-		l.mutex.Unlock()
+	addressKey, ipKey := limitKey(namespace, claim.Address), limitKey(namespace, clintIP)
+	remaining, ok, err := l.store.Reserve([]string{addressKey, ipKey}, ttl)
+	if err != nil {
+		log.WithError(err).Error("failed to reserve rate limit keys")
+		renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		renderRateLimit(w, remaining)
 		return
 	}
-	l.cache.SetWithTTL(address, true, l.ttl)
-	l.cache.SetWithTTL(clintIP, true, l.ttl)
-	l.mutex.Unlock()
 
-	next.ServeHTTP(w, r)
-	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
-		l.cache.Remove(address)
-		l.cache.Remove(clintIP)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), limitKeysContextKey{}, []string{addressKey, ipKey})))
+	if status := w.(negroni.ResponseWriter).Status(); status != http.StatusOK && status != http.StatusAccepted {
+		if err := l.store.Release(addressKey, ipKey); err != nil {
+			log.WithError(err).Error("failed to release rate limit keys")
+		}
 		return
 	}
 	log.WithFields(log.Fields{
-		"address":  address,
+		"address":  claim.Address,
 		"clientIP": clintIP,
+		"type":     claim.Type,
+		"token":    claim.Token,
 	}).Info("Maximum request limit has been reached")
 }
 
-func (l *Limiter) limitByKey(w http.ResponseWriter, key string) bool {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait for %d day(s) before you try again.", int(ttl.Round(time.Hour).Hours()/24))
-		renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
-		return true
+type limitKeysContextKey struct{}
+
+// limitKeys returns the rate limit keys the Limiter reserved for a claim, nil
+// when the claim is not rate limited.
+func limitKeys(ctx context.Context) []string {
+	keys, _ := ctx.Value(limitKeysContextKey{}).([]string)
+	return keys
+}
+
+func limitKey(namespace, key string) string {
+	if namespace == "" {
+		return key
 	}
-	return false
+	return namespace + ":" + key
+}
+
+func renderRateLimit(w http.ResponseWriter, ttl time.Duration) {
+	errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait for %d day(s) before you try again.", int(ttl.Round(time.Hour).Hours()/24))
+	renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
 }
 
 func getClientIPFromRequest(proxyCount int, r *http.Request) string {
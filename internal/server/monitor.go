@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/alert"
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
+const claimFailuresAlert = "claim-failures"
+
+// Monitor polls the token and native coin balances of every funding account
+// and alerts when one drops below its threshold, when an RPC endpoint serves
+// another chain, or when several claims in a row fail. The balances
+// of the last poll are kept for /api/info, so page loads do not read them.
+type Monitor struct {
+	mutex            sync.Mutex
+	builder          chain.TxBuilder
+	cfg              *Config
+	notifier         *alert.Notifier
+	interval         time.Duration
+	nativeThreshold  *big.Int
+	failureThreshold int
+	failures         int
+	balances         map[common.Address]*big.Int
+	reserves         map[string]*big.Int
+}
+
+// NewMonitor creates a monitor checking the balances every interval. A nil
+// native threshold leaves the native balance unchecked and a zero failure
+// threshold disables alerts on failing claims.
+func NewMonitor(builder chain.TxBuilder, cfg *Config, notifier *alert.Notifier, interval time.Duration, nativeThreshold *big.Int, failureThreshold int) *Monitor {
+	return &Monitor{
+		builder:          builder,
+		cfg:              cfg,
+		notifier:         notifier,
+		interval:         interval,
+		nativeThreshold:  nativeThreshold,
+		failureThreshold: failureThreshold,
+	}
+}
+
+// Run checks the balances until the context is canceled.
+func (m *Monitor) Run(ctx context.Context) {
+	m.checkBalances(ctx)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.checkBalances(ctx)
+		}
+	}
+}
+
+func (m *Monitor) checkBalances(ctx context.Context) {
+	accounts := m.builder.Accounts()
+	balances := make(map[common.Address]*big.Int, len(accounts))
+	// The reserve of a token is only known when the balance of every account was read
+	reserves := make(map[string]*big.Int)
+	for _, token := range m.cfg.tokens {
+		if scalesPayout(token) {
+			reserves[token.Address] = new(big.Int)
+		}
+	}
+	for _, account := range accounts {
+		m.checkAccount(ctx, account.Address, balances, reserves)
+	}
+	m.mutex.Lock()
+	m.balances, m.reserves = balances, reserves
+	m.mutex.Unlock()
+	m.checkProviders(ctx)
+}
+
+// nativeBalance returns the native coin balance of a funding account read by
+// the last poll.
+func (m *Monitor) nativeBalance(account common.Address) (*big.Int, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	balance, ok := m.balances[account]
+	return balance, ok
+}
+
+// reserve returns the balance of token summed over the funding accounts read
+// by the last poll. It is only read for tokens that scale their payout.
+func (m *Monitor) reserve(token registry.Token) (*big.Int, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	reserve, ok := m.reserves[token.Address]
+	return reserve, ok
+}
+
+// checkProviders alerts while an RPC endpoint serves another chain than the
+// faucet signs for, such as a misrouted endpoint behind a load balancer.
+func (m *Monitor) checkProviders(ctx context.Context) {
+	for _, provider := range m.builder.Providers() {
+		key := "wrong-chain:" + provider.URL
+		if provider.WrongChain {
+			m.notifier.Fire(ctx, key, fmt.Sprintf("RPC provider %s serves chain %s instead of chain %s and is out of rotation", provider.URL, provider.ChainID, m.builder.ChainID()))
+			continue
+		}
+		m.notifier.Resolve(ctx, key, fmt.Sprintf("RPC provider %s serves chain %s again", provider.URL, m.builder.ChainID()))
+	}
+}
+
+// checkAccount checks the balances of a funding account, recording its native
+// coin balance in balances and adding its token balances to reserves.
+func (m *Monitor) checkAccount(ctx context.Context, account common.Address, balances map[common.Address]*big.Int, reserves map[string]*big.Int) {
+	for _, token := range m.cfg.tokens {
+		// The thresholds were validated on startup
+		threshold, _ := token.AlertUnits()
+		reserve, scaled := reserves[token.Address]
+		if threshold == nil && !scaled {
+			continue
+		}
+		balance, err := m.builder.TokenBalance(ctx, common.HexToAddress(token.Address), account)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"token": token.Symbol, "account": account}).Warn("failed to read faucet token balance")
+			delete(reserves, token.Address)
+			continue
+		}
+		if scaled {
+			reserve.Add(reserve, balance)
+		}
+		if threshold != nil {
+			m.checkBalance(ctx, account, token.Symbol, balance, threshold, token.Decimals)
+		}
+	}
+
+	balance, err := m.builder.BalanceAt(ctx, account)
+	if err != nil {
+		log.WithError(err).WithField("account", account).Warn("failed to read faucet native balance")
+		return
+	}
+	balances[account] = balance
+	if m.nativeThreshold != nil {
+		m.checkBalance(ctx, account, m.cfg.nativeSymbol, balance, m.nativeThreshold, 18)
+	}
+}
+
+func (m *Monitor) checkBalance(ctx context.Context, account common.Address, symbol string, balance, threshold *big.Int, decimals int) {
+	key := "low-balance:" + symbol + ":" + account.Hex()
+	if balance.Cmp(threshold) < 0 {
+		m.notifier.Fire(ctx, key, fmt.Sprintf("Faucet balance of %s %s in %s is below the threshold of %s %s",
+			chain.FormatUnits(balance, decimals), symbol, account.Hex(), chain.FormatUnits(threshold, decimals), symbol))
+		return
+	}
+	m.notifier.Resolve(ctx, key, fmt.Sprintf("Faucet balance of %s %s in %s is back above the threshold", chain.FormatUnits(balance, decimals), symbol, account.Hex()))
+}
+
+// RecordClaim counts consecutive claims that failed to send or whose
+// transaction failed, err is nil for a claim that was confirmed. Notifications are sent in the background so they do
+// not delay the claim response.
+func (m *Monitor) RecordClaim(err error) {
+	if m == nil || m.failureThreshold <= 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	if err == nil {
+		recovered := m.failures >= m.failureThreshold
+		m.failures = 0
+		m.mutex.Unlock()
+		if recovered {
+			go m.notifier.Resolve(context.Background(), claimFailuresAlert, "Claims are sent again")
+		}
+		return
+	}
+	m.failures++
+	failures := m.failures
+	m.mutex.Unlock()
+
+	if failures >= m.failureThreshold {
+		go m.notifier.Fire(context.Background(), claimFailuresAlert, fmt.Sprintf("%d claims in a row failed, last error: %v", failures, err))
+	}
+}
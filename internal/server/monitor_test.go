@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/alert"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
+// alertRecorder is a generic webhook recording the status of every alert it
+// receives.
+type alertRecorder struct {
+	mutex  sync.Mutex
+	alerts []string
+}
+
+func (r *alertRecorder) notifier(t *testing.T) *alert.Notifier {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		r.mutex.Lock()
+		r.alerts = append(r.alerts, body["status"]+" "+body["alert"])
+		r.mutex.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return alert.NewNotifier([]alert.Webhook{{URL: server.URL, Format: alert.FormatGeneric}}, "faucet", 0)
+}
+
+func (r *alertRecorder) received() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.alerts...)
+}
+
+func TestMonitor_LowBalance(t *testing.T) {
+	builder := newFakeBuilder()
+	tokens := []registry.Token{{Symbol: "LSK", Address: testTokenAddress, Decimals: 18, Payout: "1", Interval: 60, AlertBelow: "5"}}
+	cfg := NewConfig("testnet", tokens, 0, 0, "", "", "", "").
+		WithNativePayout("ETH", nativePayout, 60, false)
+	recorder := &alertRecorder{}
+	monitor := NewMonitor(builder, cfg, recorder.notifier(t), time.Minute, big.NewInt(1000), 0)
+	ctx := context.Background()
+	tokenAlert := "low-balance:LSK:" + faucetAccount.Hex()
+	nativeAlert := "low-balance:ETH:" + faucetAccount.Hex()
+
+	builder.setBalance(builder.tokenBalances, faucetAccount, big.NewInt(4000000000000000000))
+	builder.setBalance(builder.nativeBalances, faucetAccount, big.NewInt(2000))
+	monitor.checkBalances(ctx)
+	assert.Equal(t, []string{"firing " + tokenAlert}, recorder.received())
+	balance, ok := monitor.nativeBalance(faucetAccount)
+	require.True(t, ok)
+	assert.Equal(t, big.NewInt(2000), balance)
+
+	// A balance that stays low is not notified again
+	builder.setBalance(builder.nativeBalances, faucetAccount, big.NewInt(500))
+	monitor.checkBalances(ctx)
+	assert.Equal(t, []string{"firing " + tokenAlert, "firing " + nativeAlert}, recorder.received())
+
+	builder.setBalance(builder.tokenBalances, faucetAccount, big.NewInt(6000000000000000000))
+	builder.setBalance(builder.nativeBalances, faucetAccount, big.NewInt(2000))
+	monitor.checkBalances(ctx)
+	monitor.checkBalances(ctx)
+	assert.Equal(t, []string{
+		"firing " + tokenAlert,
+		"firing " + nativeAlert,
+		"resolved " + tokenAlert,
+		"resolved " + nativeAlert,
+	}, recorder.received())
+}
+
+func TestMonitor_Reserve(t *testing.T) {
+	builder := &pooledBuilder{fakeBuilder: newFakeBuilder()}
+	tokens := []registry.Token{
+		{Symbol: "LSK", Address: testTokenAddress, Decimals: 18, Payout: "1", Interval: 60, Floor: "1"},
+		{Symbol: "MNT", Address: testMintedTokenAddress, Decimals: 18, Payout: "1", Interval: 60},
+	}
+	cfg := NewConfig("testnet", tokens, 0, 0, "", "", "", "")
+	monitor := NewMonitor(builder, cfg, alert.NewNotifier(nil, "faucet", 0), time.Minute, nil, 0)
+	builder.setBalance(builder.tokenBalances, faucetAccount, big.NewInt(3))
+	builder.setBalance(builder.tokenBalances, secondAccount, big.NewInt(4))
+
+	_, ok := monitor.reserve(tokens[0])
+	assert.False(t, ok, "no reserve before the first poll")
+	monitor.checkBalances(context.Background())
+	reserve, ok := monitor.reserve(tokens[0])
+	require.True(t, ok)
+	assert.Equal(t, big.NewInt(7), reserve)
+
+	// Tokens that do not scale their payout are not read
+	_, ok = monitor.reserve(tokens[1])
+	assert.False(t, ok)
+}
+
+func TestMonitor_ClaimFailures(t *testing.T) {
+	recorder := &alertRecorder{}
+	cfg := NewConfig("testnet", nil, 0, 0, "", "", "", "")
+	monitor := NewMonitor(newFakeBuilder(), cfg, recorder.notifier(t), time.Minute, nil, 2)
+	sendErr := errors.New("insufficient funds")
+
+	monitor.RecordClaim(sendErr)
+	monitor.RecordClaim(nil)
+	monitor.RecordClaim(sendErr)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, recorder.received(), "failures must be consecutive")
+
+	monitor.RecordClaim(sendErr)
+	require.Eventually(t, func() bool {
+		return len(recorder.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	monitor.RecordClaim(nil)
+	require.Eventually(t, func() bool {
+		return len(recorder.received()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"firing " + claimFailuresAlert, "resolved " + claimFailuresAlert}, recorder.received())
+}
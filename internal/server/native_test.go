@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+var nativePayout = big.NewInt(500000000000000000)
+
+func postNativeClaim(t *testing.T, s *Server, recipient common.Address, clientIP string) (int, claimResponse) {
+	rec, resp := postClaimBody(t, s, map[string]string{"address": recipient.Hex(), "type": claimTypeNative}, clientIP)
+	return rec.Code, resp
+}
+
+func TestClaim_Native(t *testing.T) {
+	builder := newFakeBuilder()
+	s := newTestServer(builder, store.NewMemoryStore())
+	s.cfg.WithNativePayout("ETH", nativePayout, 120, false)
+
+	code, resp := postNativeClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, code, resp.Message)
+	claim := requireClaim(t, s, resp.ClaimID)
+	assert.Equal(t, claimTypeNative, claim.Type)
+	assert.Equal(t, nativePayout.String(), claim.Amount)
+
+	s.processClaim(context.Background(), <-s.queue.jobs)
+	transfers := builder.sent()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, common.Address{}, transfers[0].token)
+	assert.Equal(t, firstRecipient.Hex(), transfers[0].to)
+	assert.Equal(t, nativePayout, transfers[0].value)
+	assert.Equal(t, store.ClaimSent, requireClaim(t, s, resp.ClaimID).Status)
+
+	// Native claims have their own rate limit, apart from token claims
+	rec, resp := postClaim(t, s, firstRecipient, "192.0.2.2")
+	assert.Equal(t, http.StatusAccepted, rec.Code, resp.Message)
+	code, _ = postNativeClaim(t, s, firstRecipient, "192.0.2.3")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func TestClaim_NativeUnavailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		payout  *big.Int
+		bundled bool
+	}{
+		{name: "disabled"},
+		{name: "bundled with token claims", payout: nativePayout, bundled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+			s.cfg.WithNativePayout("ETH", tt.payout, 120, tt.bundled)
+
+			code, resp := postNativeClaim(t, s, firstRecipient, "192.0.2.1")
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, "native coin claims are not available", resp.Message)
+		})
+	}
+}
+
+func TestClaim_NativeBalanceLimit(t *testing.T) {
+	builder := newFakeBuilder()
+	builder.setBalance(builder.nativeBalances, firstRecipient, big.NewInt(2000000000000000000))
+	builder.setBalance(builder.nativeBalances, secondRecipient, big.NewInt(200000000000000000))
+	s := newTestServer(builder, store.NewMemoryStore())
+	s.cfg.WithNativePayout("ETH", nativePayout, 120, false).
+		WithNativeBalanceLimit(big.NewInt(1000000000000000000), true)
+
+	code, resp := postNativeClaim(t, s, firstRecipient, "192.0.2.1")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Contains(t, resp.Message, "already reaches the faucet limit of 0.5 ETH")
+
+	// Top-up mode sends the difference to the payout
+	code, resp = postNativeClaim(t, s, secondRecipient, "192.0.2.2")
+	require.Equal(t, http.StatusAccepted, code, resp.Message)
+	assert.Equal(t, "300000000000000000", requireClaim(t, s, resp.ClaimID).Amount)
+}
+
+func TestClaim_BundledNative(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    *big.Int
+		wantNative bool
+	}{
+		{name: "sent with the token", balance: new(big.Int), wantNative: true},
+		{name: "skipped above the balance limit", balance: big.NewInt(2000000000000000000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakeBuilder()
+			builder.setBalance(builder.nativeBalances, firstRecipient, tt.balance)
+			s := newTestServer(builder, store.NewMemoryStore())
+			s.cfg.WithNativePayout("ETH", nativePayout, 0, true).
+				WithNativeBalanceLimit(big.NewInt(1000000000000000000), false)
+
+			rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+			require.Equal(t, http.StatusAccepted, rec.Code, resp.Message)
+			s.processClaim(context.Background(), <-s.queue.jobs)
+
+			claim := requireClaim(t, s, resp.ClaimID)
+			assert.Equal(t, store.ClaimSent, claim.Status)
+			transfers := builder.sent()
+			assert.Equal(t, common.HexToAddress(testTokenAddress), transfers[0].token)
+			if !tt.wantNative {
+				assert.Len(t, transfers, 1)
+				assert.Empty(t, claim.NativeTxHash)
+				return
+			}
+			require.Len(t, transfers, 2)
+			assert.Equal(t, common.Address{}, transfers[1].token)
+			assert.Equal(t, nativePayout, transfers[1].value)
+			assert.NotEmpty(t, claim.NativeTxHash)
+			assert.NotEqual(t, claim.TxHash, claim.NativeTxHash)
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+const (
+	// claimTimeout bounds the time a worker spends on sending a claim.
+	claimTimeout = 30 * time.Second
+	// claimRetention is the time a finished claim can still be looked up.
+	claimRetention = 24 * time.Hour
+	// claimFollowInterval is the interval between checks of the transactions
+	// of sent claims.
+	claimFollowInterval = 2 * time.Second
+)
+
+var errQueueFull = errors.New("claim queue is full")
+
+// claimQueue holds the IDs of the claims accepted by the server until a
+// worker sends them. The claims themselves are kept in the store, so claims
+// still queued on shutdown are sent after a restart. Sent claims are followed
+// until their transaction is confirmed or fails.
+type claimQueue struct {
+	jobs  chan string
+	mutex sync.Mutex
+	sent  map[string]store.Claim
+}
+
+func newClaimQueue() *claimQueue {
+	return &claimQueue{sent: make(map[string]store.Claim)}
+}
+
+func (q *claimQueue) follow(claim store.Claim) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.sent[claim.ID] = claim
+}
+
+func (q *claimQueue) following() []store.Claim {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	claims := make([]store.Claim, 0, len(q.sent))
+	for _, claim := range q.sent {
+		claims = append(claims, claim)
+	}
+	return claims
+}
+
+func (q *claimQueue) unfollow(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.sent, id)
+}
+
+// startQueue resumes the claims left unfinished by a previous run and starts
+// the workers sending queued claims.
+func (s *Server) startQueue(ctx context.Context) error {
+	claims, err := s.store.UnfinishedClaims()
+	if err != nil {
+		return err
+	}
+	s.queue.jobs = make(chan string, max(s.cfg.queueSize, len(claims)))
+	for _, claim := range claims {
+		switch claim.Status {
+		case store.ClaimSending:
+			s.interruptClaim(claim)
+		case store.ClaimSent:
+			s.WatchTransaction(common.HexToHash(claim.TxHash))
+			s.queue.follow(claim)
+		default:
+			s.queue.jobs <- claim.ID
+		}
+	}
+	if len(claims) > 0 {
+		log.WithField("claims", len(claims)).Info("Resumed unfinished claims")
+	}
+
+	if s.cfg.batchEnabled() {
+		s.batches = make(chan payout, s.cfg.queueSize)
+		go s.runBatches(ctx)
+	}
+	for i := 0; i < s.cfg.queueWorkers; i++ {
+		go s.work(ctx)
+	}
+	go s.followClaims(ctx)
+	return nil
+}
+
+// enqueueClaim computes the payout of a claim, charges it to the budgets,
+// stores the claim and queues it for the workers. limitKeys are the rate
+// limit keys reserved for it.
+func (s *Server) enqueueClaim(ctx context.Context, req *claimRequest, limitKeys []string) (store.Claim, error) {
+	id, err := newClaimID()
+	if err != nil {
+		return store.Claim{}, err
+	}
+	now := time.Now().UTC()
+	claim := store.Claim{
+		ID:        id,
+		Status:    store.ClaimQueued,
+		Type:      req.Type,
+		Address:   req.Address,
+		Token:     req.Token,
+		LimitKeys: limitKeys,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if claim, err = s.chargeClaim(ctx, claim); err != nil {
+		return store.Claim{}, err
+	}
+	if err := s.store.SaveClaim(claim, claimRetention); err != nil {
+		s.refundBudget(claim.Charges)
+		return store.Claim{}, err
+	}
+	s.events.publish(claim)
+
+	select {
+	case s.queue.jobs <- claim.ID:
+		return claim, nil
+	default:
+		// The limiter releases the keys of the refused request
+		s.refundBudget(claim.Charges)
+		claim.Status, claim.Charges, claim.Error = store.ClaimFailed, nil, errQueueFull.Error()
+		s.saveClaim(claim)
+		return store.Claim{}, errQueueFull
+	}
+}
+
+// chargeClaim computes the amount paid out for a claim, refusing recipients
+// above the balance limit and tokens whose claims are paused, and charges it
+// to the budgets.
+func (s *Server) chargeClaim(ctx context.Context, claim store.Claim) (store.Claim, error) {
+	recipient := common.HexToAddress(claim.Address)
+	var token *registry.Token
+	var amount *big.Int
+	var err error
+	if claim.Type == claimTypeNative {
+		amount, err = s.nativeAmount(ctx, recipient)
+	} else {
+		// The token was validated by the handler
+		t, _ := s.cfg.token(claim.Token)
+		token = &t
+		amount, err = s.tokenAmount(ctx, t, recipient)
+	}
+	if err != nil {
+		return store.Claim{}, err
+	}
+	if claim.Charges, err = s.spendBudget(token, amount); err != nil {
+		return store.Claim{}, err
+	}
+	claim.Amount = amount.String()
+	return claim, nil
+}
+
+func (s *Server) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue.jobs:
+			s.processClaim(ctx, id)
+		}
+	}
+}
+
+// processClaim sends a queued claim, or hands it to the batcher. Claims
+// shared with other replicas through the store are only sent by the replica
+// that starts them.
+func (s *Server) processClaim(ctx context.Context, id string) {
+	claim, ok, err := s.store.StartClaim(id)
+	if err != nil {
+		log.WithError(err).WithField("claim", id).Error("failed to start queued claim")
+		return
+	}
+	if !ok {
+		return
+	}
+	s.events.publish(claim)
+
+	p, err := s.claimPayout(claim)
+	if err != nil {
+		s.failClaim(claim, err)
+		return
+	}
+	if s.batchable(p) {
+		s.batches <- p
+		return
+	}
+	s.sendPayout(ctx, p)
+}
+
+// payout is a claim with the token and amount it pays out.
+type payout struct {
+	claim  store.Claim
+	token  *registry.Token // nil for native coin claims
+	amount *big.Int
+}
+
+// claimPayout returns the payout of a claim, the amount charged when it was
+// queued.
+func (s *Server) claimPayout(claim store.Claim) (payout, error) {
+	amount, ok := new(big.Int).SetString(claim.Amount, 10)
+	if !ok {
+		return payout{}, errors.New("invalid claim amount")
+	}
+	p := payout{claim: claim, amount: amount}
+	if claim.Type != claimTypeNative {
+		// The token may have been removed from the registry since the claim was queued
+		token, ok := s.cfg.token(claim.Token)
+		if !ok {
+			return payout{}, errors.New("unknown token")
+		}
+		p.token = &token
+	}
+	return p, nil
+}
+
+// sendPayout sends a payout in a transaction of its own.
+func (s *Server) sendPayout(ctx context.Context, p payout) {
+	ctx, cancel := context.WithTimeout(ctx, claimTimeout)
+	defer cancel()
+	claim := p.claim
+	// The bundled native payout is sent with ctx, so it does not report its transaction as the claim's
+	signedCtx := chain.WithSignedHook(ctx, func(hash common.Hash) { s.publishSigned(claim, hash) })
+
+	var txHash common.Hash
+	var err error
+	if p.token == nil {
+		txHash, err = s.TransferETH(signedCtx, claim.Address, p.amount)
+	} else {
+		txHash, err = s.sendToken(signedCtx, *p.token, claim.Address, p.amount)
+	}
+	if err != nil {
+		s.monitor.RecordClaim(err)
+		s.failClaim(claim, err)
+		return
+	}
+
+	fields := log.Fields{"txHash": txHash, "address": claim.Address, "claim": claim.ID}
+	if p.token == nil {
+		log.WithFields(fields).Info("Native transaction sent successfully")
+	} else {
+		log.WithFields(fields).WithField("token", p.token.Symbol).Info("Transaction sent successfully")
+	}
+	s.claimSent(ctx, p, txHash, false)
+}
+
+// claimSent records the transaction of a claim and sends the native payout
+// bundled with a token claim, unless it was sent before.
+func (s *Server) claimSent(ctx context.Context, p payout, txHash common.Hash, batched bool) {
+	claim := p.claim
+	if p.token != nil && s.cfg.nativeEnabled() && s.cfg.nativeBundled && claim.NativeTxHash == "" {
+		claim.NativeTxHash = s.sendBundledNative(ctx, claim.Address)
+	}
+	claim.Status, claim.TxHash, claim.Batched = store.ClaimSent, txHash.Hex(), batched
+	s.saveClaim(claim)
+	s.queue.follow(claim)
+}
+
+// publishSigned reports the signed transaction of a claim to the event
+// streams following it. It runs while the nonce of the sending account is
+// locked, so the claim is only stored once the transaction was broadcast.
+func (s *Server) publishSigned(claim store.Claim, hash common.Hash) {
+	claim.TxHash, claim.UpdatedAt = hash.Hex(), time.Now().UTC()
+	s.events.publish(claim)
+}
+
+// failClaim records why a claim was not paid out, refunds its budget charges
+// and releases its rate limit keys, so the recipient may claim again.
+func (s *Server) failClaim(claim store.Claim, err error) {
+	log.WithError(err).WithField("claim", claim.ID).Error("failed to send transaction")
+	claim.Status, claim.Error = store.ClaimFailed, err.Error()
+	s.releaseClaim(&claim)
+	s.saveClaim(claim)
+}
+
+// releaseClaim refunds the budget charges of a claim that paid nothing out and
+// releases its rate limit keys.
+func (s *Server) releaseClaim(claim *store.Claim) {
+	s.refundBudget(claim.Charges)
+	claim.Charges = nil
+	if len(claim.LimitKeys) > 0 {
+		if err := s.store.Release(claim.LimitKeys...); err != nil {
+			log.WithError(err).WithField("claim", claim.ID).Error("failed to release rate limit keys")
+		}
+	}
+}
+
+// interruptClaim fails a claim whose worker stopped while sending it. Its
+// transaction may have gone out, so the rate limit keys are kept. A claim
+// that another replica may still be sending is only failed once its send
+// timed out.
+func (s *Server) interruptClaim(claim store.Claim) {
+	if wait := time.Until(claim.UpdatedAt.Add(claimTimeout)); wait > 0 {
+		time.AfterFunc(wait, func() {
+			current, ok, err := s.store.Claim(claim.ID)
+			if err == nil && ok && current.Status == store.ClaimSending {
+				s.interruptClaim(current)
+			}
+		})
+		return
+	}
+	claim.Status = store.ClaimFailed
+	claim.Error = "The faucet stopped while sending the claim, its transaction may have been sent"
+	s.saveClaim(claim)
+}
+
+// followClaims updates sent claims once their transaction is confirmed or
+// fails. Claims sent before a restart are followed again by startQueue.
+func (s *Server) followClaims(ctx context.Context) {
+	ticker := time.NewTicker(claimFollowInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, claim := range s.queue.following() {
+				s.followClaim(claim)
+			}
+		}
+	}
+}
+
+func (s *Server) followClaim(claim store.Claim) {
+	state, ok := s.TransactionState(common.HexToHash(claim.TxHash))
+	if !ok {
+		s.queue.unfollow(claim.ID)
+		return
+	}
+	if state.Status == chain.TxPending {
+		// Mined, but not yet deep enough to be confirmed
+		if state.BlockNumber == 0 || claim.BlockNumber != 0 {
+			return
+		}
+		claim.TxHash, claim.BlockNumber = state.Hash.Hex(), state.BlockNumber
+		s.queue.follow(claim)
+		s.saveClaim(claim)
+		return
+	}
+
+	s.queue.unfollow(claim.ID)
+	if !s.stillSent(claim) {
+		return
+	}
+	switch state.Status {
+	case chain.TxConfirmed:
+		s.monitor.RecordClaim(nil)
+		claim.Status, claim.TxHash, claim.BlockNumber = store.ClaimConfirmed, state.Hash.Hex(), state.BlockNumber
+	case chain.TxFailed:
+		if state.BlockNumber == 0 {
+			s.monitor.RecordClaim(errors.New(state.Error))
+			// A transaction dropped from the mempool may still be mined, so the
+			// claim keeps its rate limits and budget charges
+			claim.Status, claim.Error = store.ClaimFailed, state.Error
+			break
+		}
+		if claim.Batched {
+			go s.resendBatched(claim, state.Error)
+			return
+		}
+		// The transaction reverted and paid nothing out, the recipient may claim again
+		s.monitor.RecordClaim(errors.New(state.Error))
+		claim.Status, claim.TxHash, claim.Error = store.ClaimFailed, state.Hash.Hex(), state.Error
+		s.releaseClaim(&claim)
+	}
+	s.saveClaim(claim)
+}
+
+// stillSent reports whether the stored claim is still sent. Replicas sharing
+// the store resume the sent claims of each other after a restart, so another
+// replica may have finished the claim already.
+func (s *Server) stillSent(claim store.Claim) bool {
+	current, ok, err := s.store.Claim(claim.ID)
+	if err != nil {
+		log.WithError(err).WithField("claim", claim.ID).Error("failed to read claim")
+		return true
+	}
+	return ok && current.Status == store.ClaimSent
+}
+
+// saveClaim stores an update of a claim and reports it to the event streams
+// following the claim.
+func (s *Server) saveClaim(claim store.Claim) {
+	claim.UpdatedAt = time.Now().UTC()
+	if err := s.store.SaveClaim(claim, claimRetention); err != nil {
+		log.WithError(err).WithField("claim", claim.ID).Error("failed to save claim")
+	}
+	s.events.publish(claim)
+}
+
+func newClaimID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
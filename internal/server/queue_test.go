@@ -0,0 +1,391 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
+)
+
+const testTokenAddress = "0x8a21CF9Ba08Ae709D64Cb25AfAA951183EC9FF6D"
+
+var (
+	faucetAccount   = common.HexToAddress("0x7EF5A6135f1FD6a02593eEdC869c6D41D934aef8")
+	firstRecipient  = common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	secondRecipient = common.HexToAddress("0x5A7BaF9bE8A4e8E5c4D5ec7fC7eD4A1e0C5d3F21")
+	thirdRecipient  = common.HexToAddress("0x0000000000000000000000000000000000000C1a")
+)
+
+type fakeTransfer struct {
+	token common.Address
+	to    string
+	value *big.Int
+}
+
+// fakeBuilder records the transfers of the server and reports the states and
+// balances set by the test, every other chain call panics. Token balances are
+// shared by all tokens, the faucet is funded by faucetAccount.
+type fakeBuilder struct {
+	chain.TxBuilder
+	mutex          sync.Mutex
+	transfers      []fakeTransfer
+	states         map[common.Hash]chain.TxState
+	tokenBalances  map[common.Address]*big.Int
+	nativeBalances map[common.Address]*big.Int
+	allowance      *big.Int
+	// onSend is called with the hash of every transfer once it was recorded
+	onSend func(common.Hash)
+}
+
+func newFakeBuilder() *fakeBuilder {
+	return &fakeBuilder{
+		states:         make(map[common.Hash]chain.TxState),
+		tokenBalances:  make(map[common.Address]*big.Int),
+		nativeBalances: make(map[common.Address]*big.Int),
+	}
+}
+
+func (b *fakeBuilder) Sender() common.Address {
+	return faucetAccount
+}
+
+func (b *fakeBuilder) Accounts() []chain.Account {
+	return []chain.Account{{Address: faucetAccount}}
+}
+
+func (b *fakeBuilder) Providers() []chain.ProviderStatus {
+	return nil
+}
+
+func (b *fakeBuilder) TokenBalance(_ context.Context, _, account common.Address) (*big.Int, error) {
+	return b.balance(b.tokenBalances, account), nil
+}
+
+func (b *fakeBuilder) BalanceAt(_ context.Context, account common.Address) (*big.Int, error) {
+	return b.balance(b.nativeBalances, account), nil
+}
+
+func (b *fakeBuilder) balance(balances map[common.Address]*big.Int, account common.Address) *big.Int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if balance, ok := balances[account]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return new(big.Int)
+}
+
+func (b *fakeBuilder) setBalance(balances map[common.Address]*big.Int, account common.Address, balance *big.Int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	balances[account] = balance
+}
+
+func (b *fakeBuilder) send(token common.Address, to string, value *big.Int) (common.Hash, error) {
+	b.mutex.Lock()
+	b.transfers = append(b.transfers, fakeTransfer{token: token, to: to, value: value})
+	hash := common.BigToHash(big.NewInt(int64(len(b.transfers))))
+	b.states[hash] = chain.TxState{Hash: hash, Status: chain.TxPending}
+	onSend := b.onSend
+	b.mutex.Unlock()
+	if onSend != nil {
+		onSend(hash)
+	}
+	return hash, nil
+}
+
+func (b *fakeBuilder) TransferETH(_ context.Context, to string, value *big.Int) (common.Hash, error) {
+	return b.send(common.Address{}, to, value)
+}
+
+func (b *fakeBuilder) TransferERC20(_ context.Context, token common.Address, to string, value *big.Int) (common.Hash, error) {
+	return b.send(token, to, value)
+}
+
+func (b *fakeBuilder) TransferFromERC20(_ context.Context, token, _ common.Address, to string, value *big.Int) (common.Hash, error) {
+	return b.send(token, to, value)
+}
+
+func (b *fakeBuilder) Allowance(context.Context, common.Address, common.Address, common.Address) (*big.Int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.allowance == nil {
+		return new(big.Int), nil
+	}
+	return new(big.Int).Set(b.allowance), nil
+}
+
+func (b *fakeBuilder) TransactionState(hash common.Hash) (chain.TxState, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, ok := b.states[hash]
+	return state, ok
+}
+
+func (b *fakeBuilder) WatchTransaction(hash common.Hash) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.states[hash]; !ok {
+		b.states[hash] = chain.TxState{Hash: hash, Status: chain.TxPending}
+	}
+}
+
+func (b *fakeBuilder) finish(hash common.Hash, status chain.TxStatus, blockNumber uint64, reason string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.states[hash] = chain.TxState{Hash: hash, Status: status, BlockNumber: blockNumber, Error: reason}
+}
+
+func (b *fakeBuilder) sent() []fakeTransfer {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]fakeTransfer(nil), b.transfers...)
+}
+
+// newTestServer serves a token paying out 1 token per claim once an hour,
+// with a budget of 10 claims an hour. No workers are started, tests process
+// the queued claims themselves.
+func newTestServer(builder chain.TxBuilder, limitStore store.Store) *Server {
+	tokens := []registry.Token{{Symbol: "LSK", Address: testTokenAddress, Decimals: 18, Payout: "1", Interval: 60}}
+	cfg := NewConfig("testnet", tokens, 0, 0, "", "", "", "").
+		WithClaimBudgets(10, 0).
+		WithClaimQueue(1, 1)
+	s := NewServer(builder, limitStore, cfg)
+	s.queue.jobs = make(chan string, cfg.queueSize)
+	return s
+}
+
+func postClaim(t *testing.T, s *Server, recipient common.Address, clientIP string) (*httptest.ResponseRecorder, claimResponse) {
+	return postClaimBody(t, s, map[string]string{"address": recipient.Hex()}, clientIP)
+}
+
+func postClaimBody(t *testing.T, s *Server, claim map[string]string, clientIP string) (*httptest.ResponseRecorder, claimResponse) {
+	body, err := json.Marshal(claim)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/claim", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = clientIP + ":1234"
+	rec := httptest.NewRecorder()
+	s.setupRouter().ServeHTTP(rec, req)
+
+	var resp claimResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec, resp
+}
+
+func requireClaim(t *testing.T, s *Server, id string) store.Claim {
+	claim, ok, err := s.store.Claim(id)
+	require.NoError(t, err)
+	require.True(t, ok)
+	return claim
+}
+
+func claimsUsed(t *testing.T, s *Server) *big.Int {
+	used, _, err := s.store.Usage(budget{name: claimsBudget}.key(), time.Hour)
+	require.NoError(t, err)
+	return used
+}
+
+// limitReserved reports whether the rate limit key of the recipient is still
+// reserved, the key is reserved by the check when it was free.
+func limitReserved(t *testing.T, s *Server, recipient common.Address) bool {
+	_, ok, err := s.store.Reserve([]string{recipient.Hex()}, time.Hour)
+	require.NoError(t, err)
+	return !ok
+}
+
+func TestQueue_SendAndConfirm(t *testing.T) {
+	builder := newFakeBuilder()
+	s := newTestServer(builder, store.NewMemoryStore())
+
+	rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.NotEmpty(t, resp.ClaimID)
+	claim := requireClaim(t, s, resp.ClaimID)
+	assert.Equal(t, store.ClaimQueued, claim.Status)
+	assert.Equal(t, "1000000000000000000", claim.Amount)
+	assert.Equal(t, big.NewInt(1), claimsUsed(t, s))
+
+	s.processClaim(context.Background(), <-s.queue.jobs)
+	transfers := builder.sent()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, common.HexToAddress(testTokenAddress), transfers[0].token)
+	assert.Equal(t, firstRecipient.Hex(), transfers[0].to)
+	claim = requireClaim(t, s, resp.ClaimID)
+	assert.Equal(t, store.ClaimSent, claim.Status)
+	txHash := common.HexToHash(claim.TxHash)
+
+	builder.finish(txHash, chain.TxConfirmed, 7, "")
+	for _, following := range s.queue.following() {
+		s.followClaim(following)
+	}
+	claim = requireClaim(t, s, resp.ClaimID)
+	assert.Equal(t, store.ClaimConfirmed, claim.Status)
+	assert.Equal(t, uint64(7), claim.BlockNumber)
+	assert.Empty(t, s.queue.following())
+	assert.True(t, limitReserved(t, s, firstRecipient))
+}
+
+func TestQueue_Full(t *testing.T) {
+	s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+
+	rec, _ := postClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	rec, resp := postClaim(t, s, secondRecipient, "192.0.2.2")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "The faucet is busy, please try again later", resp.Message)
+	assert.Empty(t, resp.ClaimID)
+
+	// The refused claim released its rate limits and budget charges
+	assert.False(t, limitReserved(t, s, secondRecipient))
+	assert.Equal(t, big.NewInt(1), claimsUsed(t, s))
+}
+
+func TestQueue_BudgetExhausted(t *testing.T) {
+	s := newTestServer(newFakeBuilder(), store.NewMemoryStore())
+	s.cfg.WithClaimBudgets(1, 0)
+
+	rec, _ := postClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	rec, _ = postClaim(t, s, secondRecipient, "192.0.2.2")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.False(t, limitReserved(t, s, secondRecipient))
+}
+
+func TestQueue_ResumeAfterRestart(t *testing.T) {
+	limitStore := store.NewMemoryStore()
+	now := time.Now().UTC()
+	queued := store.Claim{
+		ID:        "queued",
+		Status:    store.ClaimQueued,
+		Type:      claimTypeToken,
+		Address:   firstRecipient.Hex(),
+		Amount:    "1000",
+		LimitKeys: []string{firstRecipient.Hex()},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	sending := store.Claim{
+		ID:        "sending",
+		Status:    store.ClaimSending,
+		Type:      claimTypeToken,
+		Address:   secondRecipient.Hex(),
+		Amount:    "1000",
+		LimitKeys: []string{secondRecipient.Hex()},
+		CreatedAt: now.Add(-time.Minute),
+		UpdatedAt: now.Add(-time.Minute),
+	}
+	sent := store.Claim{
+		ID:        "sent",
+		Status:    store.ClaimSent,
+		Type:      claimTypeToken,
+		Address:   thirdRecipient.Hex(),
+		Amount:    "1000",
+		TxHash:    common.HexToHash("0xabc").Hex(),
+		LimitKeys: []string{thirdRecipient.Hex()},
+		CreatedAt: now.Add(-2 * time.Minute),
+		UpdatedAt: now.Add(-2 * time.Minute),
+	}
+	for _, claim := range []store.Claim{queued, sending, sent} {
+		require.NoError(t, limitStore.SaveClaim(claim, time.Hour))
+		_, ok, err := limitStore.Reserve(claim.LimitKeys, time.Hour)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	builder := newFakeBuilder()
+	s := newTestServer(builder, limitStore)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, s.startQueue(ctx))
+
+	require.Eventually(t, func() bool {
+		return requireClaim(t, s, queued.ID).Status == store.ClaimSent
+	}, 5*time.Second, 10*time.Millisecond)
+	transfers := builder.sent()
+	require.Len(t, transfers, 1)
+	assert.Equal(t, big.NewInt(1000), transfers[0].value)
+
+	// The interrupted claim may have been paid out, so it keeps its rate limits
+	claim := requireClaim(t, s, sending.ID)
+	assert.Equal(t, store.ClaimFailed, claim.Status)
+	assert.True(t, limitReserved(t, s, secondRecipient))
+
+	// The sent claim is followed again until its transaction is confirmed
+	builder.finish(common.HexToHash(sent.TxHash), chain.TxConfirmed, 9, "")
+	require.Eventually(t, func() bool {
+		return requireClaim(t, s, sent.ID).Status == store.ClaimConfirmed
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(9), requireClaim(t, s, sent.ID).BlockNumber)
+}
+
+func TestQueue_FinishedByAnotherReplica(t *testing.T) {
+	builder := newFakeBuilder()
+	s := newTestServer(builder, store.NewMemoryStore())
+	rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	s.processClaim(context.Background(), <-s.queue.jobs)
+	claim := requireClaim(t, s, resp.ClaimID)
+
+	// Another replica resumed the claim and saw its transaction revert first
+	failed := claim
+	failed.Status, failed.Charges = store.ClaimFailed, nil
+	require.NoError(t, s.store.SaveClaim(failed, time.Hour))
+	require.NoError(t, s.store.Release(claim.LimitKeys...))
+	s.refundBudget(claim.Charges)
+
+	builder.finish(common.HexToHash(claim.TxHash), chain.TxFailed, 5, "transaction reverted")
+	s.followClaim(claim)
+	assert.Empty(t, s.queue.following())
+	assert.Equal(t, big.NewInt(0), claimsUsed(t, s), "the charges are refunded once")
+}
+
+func TestQueue_Failed(t *testing.T) {
+	tests := []struct {
+		name        string
+		blockNumber uint64
+		reason      string
+		released    bool
+	}{
+		{name: "reverted", blockNumber: 5, reason: "transaction reverted", released: true},
+		// A dropped transaction may still be mined
+		{name: "dropped", reason: "transaction dropped from mempool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakeBuilder()
+			s := newTestServer(builder, store.NewMemoryStore())
+			rec, resp := postClaim(t, s, firstRecipient, "192.0.2.1")
+			require.Equal(t, http.StatusAccepted, rec.Code)
+			s.processClaim(context.Background(), <-s.queue.jobs)
+			claim := requireClaim(t, s, resp.ClaimID)
+
+			builder.finish(common.HexToHash(claim.TxHash), chain.TxFailed, tt.blockNumber, tt.reason)
+			s.followClaim(claim)
+			claim = requireClaim(t, s, resp.ClaimID)
+			assert.Equal(t, store.ClaimFailed, claim.Status)
+			assert.Equal(t, tt.reason, claim.Error)
+			assert.Empty(t, s.queue.following())
+			if tt.released {
+				assert.False(t, limitReserved(t, s, firstRecipient))
+				assert.Equal(t, big.NewInt(0), claimsUsed(t, s))
+			} else {
+				assert.True(t, limitReserved(t, s, firstRecipient))
+				assert.Equal(t, big.NewInt(1), claimsUsed(t, s))
+			}
+		})
+	}
+}
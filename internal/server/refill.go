@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/LiskHQ/lsk-faucet/internal/alert"
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
+// Refiller tops the funding accounts up from a treasury account. Whenever an
+// account holds less than the refill threshold of a token, the refill amount
+// is pulled to it with transferFrom, limited by the allowance the treasury
+// approved to the primary faucet account and by the treasury balance. Refills
+// that are not mined yet are deducted from both, so the refills of a pass
+// never exceed them together.
+type Refiller struct {
+	builder  chain.TxBuilder
+	cfg      *Config
+	treasury common.Address
+	notifier *alert.Notifier
+	interval time.Duration
+	pending  map[string]pendingRefill
+}
+
+// pendingRefill is a refill transaction of a token that is not mined yet.
+type pendingRefill struct {
+	token  string
+	txHash common.Hash
+	value  *big.Int
+}
+
+// treasuryFunds is the allowance and balance the treasury has left for the
+// refills of a token.
+type treasuryFunds struct {
+	allowance *big.Int
+	reserve   *big.Int
+}
+
+// NewRefiller creates a refiller checking the faucet balances every interval.
+func NewRefiller(builder chain.TxBuilder, cfg *Config, treasury common.Address, notifier *alert.Notifier, interval time.Duration) *Refiller {
+	return &Refiller{
+		builder:  builder,
+		cfg:      cfg,
+		treasury: treasury,
+		notifier: notifier,
+		interval: interval,
+		pending:  make(map[string]pendingRefill),
+	}
+}
+
+// Run refills the faucet until the context is canceled.
+func (r *Refiller) Run(ctx context.Context) {
+	r.refill(ctx)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.refill(ctx)
+		}
+	}
+}
+
+func (r *Refiller) refill(ctx context.Context) {
+	for _, token := range r.cfg.tokens {
+		// The refill amounts were validated on startup
+		below, amount, _ := token.RefillUnits()
+		if amount == nil {
+			continue
+		}
+		r.settle(token)
+
+		// The treasury is only read once an account needs a refill
+		var funds *treasuryFunds
+		for _, account := range r.builder.Accounts() {
+			fields := log.Fields{"token": token.Symbol, "account": account.Address}
+			needed, err := r.needsRefill(ctx, token, account.Address, below)
+			if err != nil {
+				log.WithError(err).WithFields(fields).Error("failed to refill faucet from treasury")
+				continue
+			}
+			if !needed {
+				continue
+			}
+			if funds == nil {
+				if funds, err = r.treasuryFunds(ctx, token); err != nil {
+					log.WithError(err).WithFields(fields).Error("failed to refill faucet from treasury")
+					break
+				}
+			}
+			if err := r.refillToken(ctx, token, account.Address, amount, funds); err != nil {
+				log.WithError(err).WithFields(fields).Error("failed to refill faucet from treasury")
+			}
+		}
+	}
+}
+
+// settle forgets the refills of token that are no longer pending, their value
+// is reflected by the allowance and balances on chain.
+func (r *Refiller) settle(token registry.Token) {
+	for key, refill := range r.pending {
+		if refill.token != token.Symbol {
+			continue
+		}
+		if state, ok := r.builder.TransactionState(refill.txHash); ok && state.Status == chain.TxPending {
+			continue
+		}
+		delete(r.pending, key)
+	}
+}
+
+// needsRefill reports whether account holds less than below of token and has
+// no refill pending, its balance only grows once the refill is mined.
+func (r *Refiller) needsRefill(ctx context.Context, token registry.Token, account common.Address, below *big.Int) (bool, error) {
+	if _, ok := r.pending[pendingKey(token, account)]; ok {
+		return false, nil
+	}
+	balance, err := r.builder.TokenBalance(ctx, common.HexToAddress(token.Address), account)
+	if err != nil {
+		return false, err
+	}
+	return balance.Cmp(below) < 0, nil
+}
+
+// treasuryFunds reads the allowance and balance of the treasury for token,
+// less the refills that are still pending.
+func (r *Refiller) treasuryFunds(ctx context.Context, token registry.Token) (*treasuryFunds, error) {
+	tokenAddress := common.HexToAddress(token.Address)
+	allowance, err := r.builder.Allowance(ctx, tokenAddress, r.treasury, r.builder.Sender())
+	if err != nil {
+		return nil, err
+	}
+	reserve, err := r.builder.TokenBalance(ctx, tokenAddress, r.treasury)
+	if err != nil {
+		return nil, err
+	}
+	funds := &treasuryFunds{allowance: new(big.Int).Set(allowance), reserve: new(big.Int).Set(reserve)}
+	for _, refill := range r.pending {
+		if refill.token == token.Symbol {
+			funds.spend(refill.value)
+		}
+	}
+	return funds, nil
+}
+
+// spend deducts a refill of value from the funds.
+func (f *treasuryFunds) spend(value *big.Int) {
+	f.allowance = maxBig(new(big.Int).Sub(f.allowance, value), new(big.Int))
+	f.reserve = maxBig(new(big.Int).Sub(f.reserve, value), new(big.Int))
+}
+
+// refillToken pulls amount of token from the treasury to account, or as much
+// as the funds left allow.
+func (r *Refiller) refillToken(ctx context.Context, token registry.Token, account common.Address, amount *big.Int, funds *treasuryFunds) error {
+	value := minBig(amount, minBig(funds.allowance, funds.reserve))
+	key := "refill:" + token.Symbol
+	if value.Sign() <= 0 {
+		r.notifier.Fire(ctx, key, fmt.Sprintf("Cannot refill %s from treasury %s, allowance is %s %s and balance is %s %s",
+			token.Symbol, r.treasury.Hex(), chain.FormatUnits(funds.allowance, token.Decimals), token.Symbol, chain.FormatUnits(funds.reserve, token.Decimals), token.Symbol))
+		return nil
+	}
+
+	txHash, err := r.builder.TransferFromERC20(ctx, common.HexToAddress(token.Address), r.treasury, account.Hex(), value)
+	if err != nil {
+		return err
+	}
+	funds.spend(value)
+	r.pending[pendingKey(token, account)] = pendingRefill{token: token.Symbol, txHash: txHash, value: value}
+	log.WithFields(log.Fields{
+		"txHash":  txHash,
+		"token":   token.Symbol,
+		"account": account,
+		"amount":  chain.FormatUnits(value, token.Decimals),
+	}).Info("refilled faucet from treasury")
+
+	if value.Cmp(amount) < 0 {
+		r.notifier.Fire(ctx, key, fmt.Sprintf("Refilled only %s %s of %s %s from treasury %s, the allowance or the treasury is exhausted",
+			chain.FormatUnits(value, token.Decimals), token.Symbol, chain.FormatUnits(amount, token.Decimals), token.Symbol, r.treasury.Hex()))
+	} else {
+		r.notifier.Resolve(ctx, key, fmt.Sprintf("Refilled %s %s from treasury %s", chain.FormatUnits(value, token.Decimals), token.Symbol, r.treasury.Hex()))
+	}
+	return nil
+}
+
+func pendingKey(token registry.Token, account common.Address) string {
+	return token.Symbol + ":" + account.Hex()
+}
+
+func minBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return a
+	}
+	return b
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) > 0 {
+		return a
+	}
+	return b
+}
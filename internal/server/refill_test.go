@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/LiskHQ/lsk-faucet/internal/alert"
+	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+)
+
+var treasuryAccount = common.HexToAddress("0x0000000000000000000000000000000000007Ea5")
+
+// newTestRefiller refills 100 units of a token to every funding account
+// holding less than 10.
+func newTestRefiller(builder chain.TxBuilder) *Refiller {
+	tokens := []registry.Token{{Symbol: "LSK", Address: testTokenAddress, Payout: "1", Interval: 60, RefillBelow: "10", RefillAmount: "100"}}
+	cfg := NewConfig("testnet", tokens, 0, 0, "", "", "", "")
+	return NewRefiller(builder, cfg, treasuryAccount, alert.NewNotifier(nil, "faucet", 0), time.Minute)
+}
+
+// refilled returns the value refilled to every account.
+func refilled(builder *fakeBuilder) map[string]*big.Int {
+	values := make(map[string]*big.Int)
+	for _, transfer := range builder.sent() {
+		values[transfer.to] = transfer.value
+	}
+	return values
+}
+
+func TestRefiller_Threshold(t *testing.T) {
+	builder := newFakeBuilder()
+	builder.allowance = big.NewInt(1000)
+	builder.setBalance(builder.tokenBalances, treasuryAccount, big.NewInt(1000))
+	builder.setBalance(builder.tokenBalances, faucetAccount, big.NewInt(9))
+	builder.setBalance(builder.tokenBalances, secondAccount, big.NewInt(10))
+	refiller := newTestRefiller(&pooledBuilder{fakeBuilder: builder})
+
+	refiller.refill(context.Background())
+	assert.Equal(t, map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100)}, refilled(builder))
+}
+
+func TestRefiller_Pending(t *testing.T) {
+	builder := newFakeBuilder()
+	builder.allowance = big.NewInt(1000)
+	builder.setBalance(builder.tokenBalances, treasuryAccount, big.NewInt(1000))
+	refiller := newTestRefiller(builder)
+	ctx := context.Background()
+
+	// The balance only grows once the refill is mined
+	refiller.refill(ctx)
+	refiller.refill(ctx)
+	transfers := builder.sent()
+	require.Len(t, transfers, 1)
+
+	builder.finish(common.BigToHash(big.NewInt(1)), chain.TxConfirmed, 1, "")
+	refiller.refill(ctx)
+	assert.Len(t, builder.sent(), 2)
+}
+
+func TestRefiller_Funds(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowance int64
+		reserve   int64
+		want      map[string]*big.Int
+	}{
+		{
+			name:      "allowance covers both accounts",
+			allowance: 1000,
+			reserve:   1000,
+			want:      map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100), secondAccount.Hex(): big.NewInt(100)},
+		},
+		{
+			name:      "allowance shared by the accounts",
+			allowance: 150,
+			reserve:   1000,
+			want:      map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100), secondAccount.Hex(): big.NewInt(50)},
+		},
+		{
+			name:      "treasury balance shared by the accounts",
+			allowance: 1000,
+			reserve:   120,
+			want:      map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100), secondAccount.Hex(): big.NewInt(20)},
+		},
+		{
+			name:      "allowance used up by the first account",
+			allowance: 100,
+			reserve:   1000,
+			want:      map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := newFakeBuilder()
+			builder.allowance = big.NewInt(tt.allowance)
+			builder.setBalance(builder.tokenBalances, treasuryAccount, big.NewInt(tt.reserve))
+			refiller := newTestRefiller(&pooledBuilder{fakeBuilder: builder})
+
+			refiller.refill(context.Background())
+			assert.Equal(t, tt.want, refilled(builder))
+		})
+	}
+}
+
+func TestRefiller_PendingFunds(t *testing.T) {
+	builder := newFakeBuilder()
+	builder.allowance = big.NewInt(150)
+	builder.setBalance(builder.tokenBalances, treasuryAccount, big.NewInt(1000))
+	builder.setBalance(builder.tokenBalances, secondAccount, big.NewInt(10))
+	refiller := newTestRefiller(&pooledBuilder{fakeBuilder: builder})
+	ctx := context.Background()
+
+	refiller.refill(ctx)
+	require.Len(t, builder.sent(), 1)
+
+	// The allowance on chain still includes the pending refill
+	builder.setBalance(builder.tokenBalances, secondAccount, big.NewInt(0))
+	refiller.refill(ctx)
+	assert.Equal(t, map[string]*big.Int{faucetAccount.Hex(): big.NewInt(100), secondAccount.Hex(): big.NewInt(50)}, refilled(builder))
+}
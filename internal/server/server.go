@@ -2,52 +2,79 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"math/big"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
 
 	"github.com/LiskHQ/lsk-faucet/internal/chain"
+	"github.com/LiskHQ/lsk-faucet/internal/registry"
+	"github.com/LiskHQ/lsk-faucet/internal/store"
 	"github.com/LiskHQ/lsk-faucet/web"
 )
 
 type Server struct {
 	chain.TxBuilder
-	cfg *Config
+	store   store.Store
+	cfg     *Config
+	monitor *Monitor
+	queue   *claimQueue
+	events  *claimBroker
+	batches chan payout
 }
 
-func NewServer(builder chain.TxBuilder, cfg *Config) *Server {
+func NewServer(builder chain.TxBuilder, store store.Store, cfg *Config) *Server {
 	return &Server{
 		TxBuilder: builder,
+		store:     store,
 		cfg:       cfg,
+		queue:     newClaimQueue(),
+		events:    newClaimBroker(),
 	}
 }
 
+// WithMonitor reports the outcome of every claim to the monitor, which alerts
+// when claims keep failing. /api/info reports the balances polled by the
+// monitor and leaves them out without one.
+func (s *Server) WithMonitor(monitor *Monitor) *Server {
+	s.monitor = monitor
+	return s
+}
+
 func (s *Server) setupRouter() *http.ServeMux {
 	router := http.NewServeMux()
 	router.Handle("/", http.FileServer(web.Dist()))
 	router.Handle("/health", s.handleHealthCheck())
-	limiter := NewLimiter(s.cfg.proxyCount, time.Duration(s.cfg.interval)*time.Minute)
+	limiter := NewLimiter(s.store, s.cfg.proxyCount, s.cfg.claimLimit)
 	hcaptcha := NewCaptcha(s.cfg.hcaptchaSiteKey, s.cfg.hcaptchaSecret)
 	router.Handle("/api/claim", negroni.New(limiter, hcaptcha, negroni.Wrap(s.handleClaim())))
+	router.Handle("GET /api/claim/{txhash}", s.handleClaimStatus())
+	router.Handle("GET /api/claims/{id}", s.handleQueuedClaim())
+	router.Handle("GET /api/claims/{id}/events", s.handleClaimEvents())
 	router.Handle("/api/info", s.handleInfo())
+	router.Handle("GET /api/providers", s.handleProviders())
 
 	return router
 }
 
 func (s *Server) Run() {
+	if err := s.startQueue(context.Background()); err != nil {
+		log.WithError(err).Fatal("failed to resume queued claims")
+	}
 	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
 	n.UseHandler(s.setupRouter())
 	log.Infof("Starting http server %d", s.cfg.httpPort)
 	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.cfg.httpPort), n))
 }
 
+// handleClaim validates a claim, checks the recipient balance, the faucet
+// reserve and the budgets, and queues the claim. The claim is sent in the
+// background and reported by handleQueuedClaim.
 func (s *Server) handleClaim() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -55,29 +82,136 @@ func (s *Server) handleClaim() http.HandlerFunc {
 			return
 		}
 		// The error always be nil since it has already been handled in limiter
-		address, _ := readAddress(r)
+		claim, _ := readClaim(r)
+		if claim.Type == claimTypeNative {
+			if !s.cfg.nativeEnabled() || s.cfg.nativeBundled {
+				renderJSON(w, claimResponse{Message: "native coin claims are not available"}, http.StatusBadRequest)
+				return
+			}
+		} else if _, ok := s.cfg.token(claim.Token); !ok {
+			renderJSON(w, claimResponse{Message: "unknown token"}, http.StatusBadRequest)
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
-
-		currBalance, err := s.GetContractInstance().BalanceOf(&bind.CallOpts{}, common.HexToAddress(address))
+		queued, err := s.enqueueClaim(ctx, claim, limitKeys(r.Context()))
 		if err != nil {
-			log.WithError(err).Error("failed to fetch recipient balance")
-			currBalance = big.NewInt(0)
+			renderClaimError(w, err)
+			return
 		}
+		renderJSON(w, claimResponse{Message: "Your claim is queued", ClaimID: queued.ID}, http.StatusAccepted)
+	}
+}
+
+// renderClaimError answers a claim that was not queued.
+func renderClaimError(w http.ResponseWriter, err error) {
+	var balanceErr *balanceError
+	if errors.As(err, &balanceErr) {
+		renderJSON(w, claimResponse{Message: balanceErr.Error()}, http.StatusForbidden)
+		return
+	}
+	var pausedErr *pausedError
+	if errors.As(err, &pausedErr) {
+		renderJSON(w, claimResponse{Message: pausedErr.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+	var budgetErr *budgetError
+	if errors.As(err, &budgetErr) {
+		w.Header().Set("Retry-After", retryAfter(budgetErr.reset))
+		renderJSON(w, claimResponse{Message: budgetErr.Error()}, http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, errQueueFull) {
+		renderJSON(w, claimResponse{Message: "The faucet is busy, please try again later"}, http.StatusServiceUnavailable)
+		return
+	}
+	log.WithError(err).Error("failed to queue claim")
+	renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+}
+
+// sendBundledNative sends the native payout bundled with a token claim and
+// returns its transaction hash. The token claim already went out, so failures
+// are only logged and the claim still succeeds.
+func (s *Server) sendBundledNative(ctx context.Context, address string) string {
+	amount, err := s.nativeAmount(ctx, common.HexToAddress(address))
+	var balanceErr *balanceError
+	if errors.As(err, &balanceErr) {
+		log.WithField("address", address).Debug("Skipped bundled native transaction, recipient balance above limit")
+		return ""
+	}
+	if err == nil {
+		var txHash common.Hash
+		if txHash, err = s.TransferETH(ctx, address, amount); err == nil {
+			return txHash.Hex()
+		}
+	}
+	log.WithError(err).WithField("address", address).Error("failed to send bundled native transaction")
+	return ""
+}
+
+func (s *Server) handleClaimStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txHash := r.PathValue("txhash")
+		if !chain.IsValidTxHash(txHash) {
+			renderJSON(w, claimResponse{Message: "invalid transaction hash"}, http.StatusBadRequest)
+			return
+		}
+
+		state, ok := s.TransactionState(common.HexToHash(txHash))
+		if !ok {
+			renderJSON(w, claimResponse{Message: "transaction not found"}, http.StatusNotFound)
+			return
+		}
+		replaced := make([]string, len(state.Replaced))
+		for i, hash := range state.Replaced {
+			replaced[i] = hash.Hex()
+		}
+		renderJSON(w, claimStatusResponse{
+			TxHash:        state.Hash.Hex(),
+			Status:        string(state.Status),
+			BlockNumber:   state.BlockNumber,
+			GasUsed:       state.GasUsed,
+			Confirmations: state.Confirmations,
+			Error:         state.Error,
+			Replaced:      replaced,
+		}, http.StatusOK)
+	}
+}
 
-		txHash, err := s.TransferERC20(ctx, address, chain.TokenToWei(s.cfg.payout, s.cfg.tokenDecimals), currBalance)
+// handleQueuedClaim reports the progress of a queued claim.
+func (s *Server) handleQueuedClaim() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claim, ok, err := s.store.Claim(r.PathValue("id"))
 		if err != nil {
-			log.WithError(err).Error("failed to send transaction")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusInternalServerError)
+			log.WithError(err).Error("failed to read claim")
+			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			renderJSON(w, claimResponse{Message: "claim not found"}, http.StatusNotFound)
 			return
 		}
+		renderJSON(w, queuedClaimInfo(claim), http.StatusOK)
+	}
+}
 
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": address,
-		}).Info("Transaction sent successfully")
-		resp := claimResponse{Message: fmt.Sprintf("txhash: %s", txHash)}
-		renderJSON(w, resp, http.StatusOK)
+func queuedClaimInfo(claim store.Claim) queuedClaimResponse {
+	return queuedClaimResponse{
+		ID:           claim.ID,
+		Status:       string(claim.Status),
+		Event:        claimEvent(claim),
+		Type:         claim.Type,
+		Address:      claim.Address,
+		Token:        claim.Token,
+		TxHash:       claim.TxHash,
+		NativeTxHash: claim.NativeTxHash,
+		Amount:       claim.Amount,
+		Batched:      claim.Batched,
+		BlockNumber:  claim.BlockNumber,
+		Error:        claim.Error,
+		CreatedAt:    claim.CreatedAt,
+		UpdatedAt:    claim.UpdatedAt,
 	}
 }
 
@@ -87,15 +221,138 @@ func (s *Server) handleInfo() http.HandlerFunc {
 			http.NotFound(w, r)
 			return
 		}
-		renderJSON(w, infoResponse{
-			Account:         s.Sender().String(),
-			Network:         s.cfg.network,
-			Symbol:          s.cfg.symbol,
-			Payout:          strconv.FormatFloat(s.cfg.payout, 'f', -1, 64),
-			HcaptchaSiteKey: s.cfg.hcaptchaSiteKey,
-			ExplorerURL:     s.cfg.explorerURL,
-			ExplorerTxPath:  s.cfg.explorerTxPath,
-		}, http.StatusOK)
+		tokens := make([]tokenInfo, 0, len(s.cfg.tokens))
+		for _, token := range s.cfg.tokens {
+			tokens = append(tokens, s.tokenInfo(token))
+		}
+		defaultToken := tokens[0]
+		info := infoResponse{
+			Account:              s.Sender().String(),
+			Network:              s.cfg.network,
+			ChainID:              s.ChainID().String(),
+			Symbol:               defaultToken.Symbol,
+			TokenName:            defaultToken.Name,
+			TokenAddress:         defaultToken.Address,
+			TokenDecimals:        defaultToken.Decimals,
+			Payout:               defaultToken.Payout,
+			PayoutUnits:          defaultToken.PayoutUnits,
+			EffectivePayout:      defaultToken.EffectivePayout,
+			EffectivePayoutUnits: defaultToken.EffectivePayoutUnits,
+			Paused:               defaultToken.Paused,
+			HcaptchaSiteKey:      s.cfg.hcaptchaSiteKey,
+			ExplorerURL:          s.cfg.explorerURL,
+			ExplorerTxPath:       s.cfg.explorerTxPath,
+			Accounts:             s.accountInfos(),
+			Tokens:               tokens,
+			Budgets:              s.budgetInfos(),
+		}
+		if s.cfg.nativeEnabled() {
+			info.NativePayout = chain.FormatUnits(s.cfg.nativePayout, 18)
+			info.NativePayoutUnits = s.cfg.nativePayout.String()
+			info.NativeSymbol = s.cfg.nativeSymbol
+			info.NativeBundled = s.cfg.nativeBundled
+			info.NativeTopUp = s.cfg.nativeTopUp
+			if s.cfg.nativeMaxBalance != nil {
+				info.NativeMaxBalance = chain.FormatUnits(s.cfg.nativeMaxBalance, 18)
+			}
+		}
+		renderJSON(w, info, http.StatusOK)
+	}
+}
+
+// accountInfos describes the funding accounts with their native coin balance
+// polled by the monitor, which is left out when it could not be read.
+func (s *Server) accountInfos() []accountInfo {
+	accounts := s.Accounts()
+	infos := make([]accountInfo, len(accounts))
+	for i, account := range accounts {
+		infos[i] = accountInfo{Address: account.Address.Hex(), Pending: account.Pending}
+		if balance, ok := s.monitor.nativeBalance(account.Address); ok {
+			infos[i].Balance = chain.FormatUnits(balance, 18)
+		}
+	}
+	return infos
+}
+
+// sendToken pays amount of token to the recipient, minting it for tokens in
+// mint mode.
+func (s *Server) sendToken(ctx context.Context, token registry.Token, to string, amount *big.Int) (common.Hash, error) {
+	if token.Minted() {
+		return s.MintERC20(ctx, common.HexToAddress(token.Address), to, amount)
+	}
+	return s.TransferERC20(ctx, common.HexToAddress(token.Address), to, amount)
+}
+
+// tokenInfo describes a token with its payout at the faucet reserve polled by
+// the monitor, falling back to the configured payout when the reserve was not
+// read.
+func (s *Server) tokenInfo(token registry.Token) tokenInfo {
+	info := tokenInfo{
+		Symbol:     token.Symbol,
+		Name:       token.Name,
+		Address:    token.Address,
+		Decimals:   token.Decimals,
+		Payout:     token.Payout,
+		MaxBalance: token.MaxBalance,
+		TopUp:      token.TopUp,
+		Interval:   token.Interval,
+		Mode:       registry.ModeTransfer,
+	}
+	if token.Minted() {
+		info.Mode = registry.ModeMint
+	}
+	if payout, err := token.PayoutUnits(); err == nil {
+		info.PayoutUnits = payout.String()
+	}
+	info.EffectivePayout, info.EffectivePayoutUnits = info.Payout, info.PayoutUnits
+
+	if !scalesPayout(token) {
+		return info
+	}
+	reserve, ok := s.monitor.reserve(token)
+	if !ok {
+		return info
+	}
+	payout, err := reservePayout(token, reserve)
+	var pausedErr *pausedError
+	switch {
+	case errors.As(err, &pausedErr):
+		info.Paused = true
+		info.EffectivePayout, info.EffectivePayoutUnits = "0", "0"
+	case err != nil:
+		log.WithError(err).WithField("token", token.Symbol).Warn("failed to compute effective payout")
+	default:
+		info.EffectivePayout = chain.FormatUnits(payout, token.Decimals)
+		info.EffectivePayoutUnits = payout.String()
+	}
+	return info
+}
+
+// handleProviders reports the health of the RPC endpoints for diagnostics.
+func (s *Server) handleProviders() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		statuses := s.Providers()
+		providers := make([]providerInfo, len(statuses))
+		for i, status := range statuses {
+			providers[i] = providerInfo{
+				URL:         status.URL,
+				Healthy:     status.Healthy,
+				WrongChain:  status.WrongChain,
+				BlockNumber: status.BlockNumber,
+				LatencyMs:   status.Latency.Milliseconds(),
+				ErrorRate:   status.ErrorRate,
+				Requests:    status.Requests,
+				Failures:    status.Failures,
+				LastError:   status.LastError,
+			}
+			if status.ChainID != nil {
+				providers[i].ChainID = status.ChainID.String()
+			}
+			if !status.CheckedAt.IsZero() {
+				providers[i].CheckedAt = &statuses[i].CheckedAt
+			}
+		}
+		renderJSON(w, providers, http.StatusOK)
 	}
 }
 
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const boltPruneInterval = time.Hour
+
+var (
+	limitsBucket  = []byte("limits")
+	budgetsBucket = []byte("budgets")
+	claimsBucket  = []byte("claims")
+)
+
+// BoltStore keeps the keys, counters and claims in a BoltDB file, so rate
+// limits, budgets and queued claims survive restarts. Every key maps to its
+// expiry time, followed by the value of a counter or the JSON of a claim.
+// Expired entries are pruned periodically.
+type BoltStore struct {
+	db     *bolt.DB
+	cancel context.CancelFunc
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{limitsBucket, budgetsBucket, claimsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &BoltStore{db: db, cancel: cancel}
+	go s.prune(ctx)
+	return s, nil
+}
+
+func (s *BoltStore) Reserve(keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	var remaining time.Duration
+	reserved := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(limitsBucket)
+		now := time.Now()
+		for _, key := range keys {
+			if expiry, ok := decodeExpiry(bucket.Get([]byte(key))); ok && expiry.After(now) {
+				remaining = expiry.Sub(now)
+				return nil
+			}
+		}
+		expiry := encodeExpiry(now.Add(ttl))
+		for _, key := range keys {
+			if err := bucket.Put([]byte(key), expiry); err != nil {
+				return err
+			}
+		}
+		reserved = true
+		return nil
+	})
+	return remaining, reserved, err
+}
+
+func (s *BoltStore) Release(keys ...string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(limitsBucket)
+		for _, key := range keys {
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Spend(charges []Charge) (int, time.Time, error) {
+	refused, reset := -1, time.Time{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(budgetsBucket)
+		now := clock()
+		counters, index, windowReset, err := spend(charges, now, func(key string) (*big.Int, error) {
+			return counterValue(bucket.Get([]byte(key)), now), nil
+		})
+		if err != nil || index >= 0 {
+			refused, reset = index, windowReset
+			return err
+		}
+		for _, c := range counters {
+			if err := bucket.Put([]byte(c.key), append(encodeExpiry(c.reset), c.value.Bytes()...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return refused, reset, err
+}
+
+func (s *BoltStore) Usage(key string, window time.Duration) (*big.Int, time.Time, error) {
+	now := clock()
+	key, reset := windowKey(key, window, now)
+	var value *big.Int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value = counterValue(tx.Bucket(budgetsBucket).Get([]byte(key)), now)
+		return nil
+	})
+	return value, reset, err
+}
+
+func (s *BoltStore) SaveClaim(claim Claim, ttl time.Duration) error {
+	value, err := encodeClaim(claim)
+	if err != nil {
+		return err
+	}
+	expiry := encodeExpiry(claimExpiry(claim, ttl, time.Now()))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(claimsBucket).Put([]byte(claim.ID), append(expiry, value...))
+	})
+}
+
+func (s *BoltStore) StartClaim(id string) (Claim, bool, error) {
+	var claim Claim
+	started := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(claimsBucket)
+		value := bucket.Get([]byte(id))
+		if len(value) < 8 {
+			return nil
+		}
+		var err error
+		if claim, err = decodeClaim(value[8:]); err != nil || !claim.start(time.Now()) {
+			return err
+		}
+		encoded, err := encodeClaim(claim)
+		if err != nil {
+			return err
+		}
+		started = true
+		return bucket.Put([]byte(id), append(encodeExpiry(claimExpiry(claim, 0, time.Now())), encoded...))
+	})
+	return claim, started, err
+}
+
+func (s *BoltStore) Claim(id string) (Claim, bool, error) {
+	var claim Claim
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(claimsBucket).Get([]byte(id))
+		if expiry, ok := decodeExpiry(value); !ok || !expiry.After(time.Now()) {
+			return nil
+		}
+		var err error
+		claim, err = decodeClaim(value[8:])
+		found = err == nil
+		return err
+	})
+	return claim, found, err
+}
+
+func (s *BoltStore) UnfinishedClaims() ([]Claim, error) {
+	var claims []Claim
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(claimsBucket).ForEach(func(_, value []byte) error {
+			if len(value) < 8 {
+				return nil
+			}
+			claim, err := decodeClaim(value[8:])
+			if err != nil {
+				return err
+			}
+			if claim.Unfinished() {
+				claims = append(claims, claim)
+			}
+			return nil
+		})
+	})
+	sortClaims(claims)
+	return claims, err
+}
+
+func (s *BoltStore) Close() error {
+	s.cancel()
+	return s.db.Close()
+}
+
+func (s *BoltStore) prune(ctx context.Context) {
+	ticker := time.NewTicker(boltPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.removeExpired(time.Now()); err != nil {
+				log.WithError(err).Warn("failed to prune expired rate limit keys and claims")
+			}
+		}
+	}
+}
+
+func (s *BoltStore) removeExpired(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{limitsBucket, budgetsBucket, claimsBucket} {
+			bucket := tx.Bucket(name)
+			// Deleting while iterating with a cursor skips keys, collect them first
+			var expired [][]byte
+			err := bucket.ForEach(func(key, value []byte) error {
+				if expiry, ok := decodeExpiry(value); !ok || !expiry.After(now) {
+					expired = append(expired, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, key := range expired {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func encodeExpiry(expiry time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(expiry.UnixNano()))
+}
+
+func decodeExpiry(value []byte) (time.Time, bool) {
+	if len(value) < 8 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value[:8]))), true
+}
+
+// counterValue decodes a budget counter, which counts from zero again once
+// its window expired.
+func counterValue(value []byte, now time.Time) *big.Int {
+	if expiry, ok := decodeExpiry(value); ok && expiry.After(now) {
+		return new(big.Int).SetBytes(value[8:])
+	}
+	return new(big.Int)
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// ClaimStatus is the progress of a queued claim.
+type ClaimStatus string
+
+const (
+	ClaimQueued    ClaimStatus = "queued"
+	ClaimSending   ClaimStatus = "sending"
+	ClaimSent      ClaimStatus = "sent"
+	ClaimConfirmed ClaimStatus = "confirmed"
+	ClaimFailed    ClaimStatus = "failed"
+)
+
+// Claim is a claim accepted by the faucet and processed in the background.
+// LimitKeys are the rate limit keys reserved for the claim, released again
+// when it fails. Amount is the payout in base units and Charges are the
+// budget charges counted for it when it was queued, refunded when nothing is
+// paid out. Batched marks a claim paid out along with others in a single
+// transaction.
+type Claim struct {
+	ID           string      `json:"id"`
+	Status       ClaimStatus `json:"status"`
+	Type         string      `json:"type"`
+	Address      string      `json:"address"`
+	Token        string      `json:"token,omitempty"`
+	LimitKeys    []string    `json:"limit_keys,omitempty"`
+	Amount       string      `json:"amount,omitempty"`
+	Charges      []Charge    `json:"charges,omitempty"`
+	Batched      bool        `json:"batched,omitempty"`
+	TxHash       string      `json:"txhash,omitempty"`
+	NativeTxHash string      `json:"native_txhash,omitempty"`
+	BlockNumber  uint64      `json:"block_number,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// Unfinished reports whether the claim still waits for its transaction to be
+// sent or confirmed.
+func (c Claim) Unfinished() bool {
+	return c.Status == ClaimQueued || c.Status == ClaimSending || c.Status == ClaimSent
+}
+
+// claimExpiry returns the time a saved claim expires. Unfinished claims never
+// expire.
+func claimExpiry(claim Claim, ttl time.Duration, now time.Time) time.Time {
+	if claim.Unfinished() || ttl <= 0 {
+		return time.Unix(0, math.MaxInt64)
+	}
+	return now.Add(ttl)
+}
+
+// start moves a queued claim to ClaimSending, it returns false for claims in
+// any other state.
+func (c *Claim) start(now time.Time) bool {
+	if c.Status != ClaimQueued {
+		return false
+	}
+	c.Status = ClaimSending
+	c.UpdatedAt = now
+	return true
+}
+
+func encodeClaim(claim Claim) ([]byte, error) {
+	return json.Marshal(claim)
+}
+
+func decodeClaim(value []byte) (Claim, error) {
+	var claim Claim
+	err := json.Unmarshal(value, &claim)
+	return claim, err
+}
+
+// sortClaims orders claims by creation, the order they were queued in.
+func sortClaims(claims []Claim) {
+	sort.SliceStable(claims, func(i, j int) bool {
+		if claims[i].CreatedAt.Equal(claims[j].CreatedAt) {
+			return claims[i].ID < claims[j].ID
+		}
+		return claims[i].CreatedAt.Before(claims[j].CreatedAt)
+	})
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v2"
+)
+
+// MemoryStore keeps the keys, counters and claims in memory, so they are lost
+// on restart.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	cache    *ttlcache.Cache
+	counters map[string]counter
+	claims   map[string]storedClaim
+}
+
+type storedClaim struct {
+	claim  Claim
+	expiry time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	cache := ttlcache.NewCache()
+	cache.SkipTTLExtensionOnHit(true)
+	return &MemoryStore{
+		cache:    cache,
+		counters: make(map[string]counter),
+		claims:   make(map[string]storedClaim),
+	}
+}
+
+func (s *MemoryStore) Reserve(keys []string, ttl time.Duration) (time.Duration, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, key := range keys {
+		if _, remaining, err := s.cache.GetWithTTL(key); err == nil {
+			return remaining, false, nil
+		}
+	}
+	for _, key := range keys {
+		if err := s.cache.SetWithTTL(key, true, ttl); err != nil {
+			return 0, false, err
+		}
+	}
+	return 0, true, nil
+}
+
+func (s *MemoryStore) Release(keys ...string) error {
+	for _, key := range keys {
+		if err := s.cache.Remove(key); err != nil && err != ttlcache.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Spend(charges []Charge) (int, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := clock()
+	counters, refused, reset, err := spend(charges, now, func(key string) (*big.Int, error) {
+		return s.counterValue(key, now), nil
+	})
+	if err != nil || refused >= 0 {
+		return refused, reset, err
+	}
+	for key, c := range s.counters {
+		if !c.reset.After(now) {
+			delete(s.counters, key)
+		}
+	}
+	for _, c := range counters {
+		s.counters[c.key] = c
+	}
+	return -1, time.Time{}, nil
+}
+
+func (s *MemoryStore) Usage(key string, window time.Duration) (*big.Int, time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := clock()
+	key, reset := windowKey(key, window, now)
+	return s.counterValue(key, now), reset, nil
+}
+
+func (s *MemoryStore) counterValue(key string, now time.Time) *big.Int {
+	if c, ok := s.counters[key]; ok && c.reset.After(now) {
+		return new(big.Int).Set(c.value)
+	}
+	return new(big.Int)
+}
+
+func (s *MemoryStore) SaveClaim(claim Claim, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, stored := range s.claims {
+		if !stored.expiry.After(now) {
+			delete(s.claims, id)
+		}
+	}
+	s.claims[claim.ID] = storedClaim{claim: claim, expiry: claimExpiry(claim, ttl, now)}
+	return nil
+}
+
+func (s *MemoryStore) StartClaim(id string) (Claim, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.claims[id]
+	if !ok || !stored.claim.start(time.Now()) {
+		return Claim{}, false, nil
+	}
+	s.claims[id] = stored
+	return stored.claim, true, nil
+}
+
+func (s *MemoryStore) Claim(id string) (Claim, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.claims[id]
+	if !ok || !stored.expiry.After(time.Now()) {
+		return Claim{}, false, nil
+	}
+	return stored.claim, true, nil
+}
+
+func (s *MemoryStore) UnfinishedClaims() ([]Claim, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var claims []Claim
+	for _, stored := range s.claims {
+		if stored.claim.Unfinished() {
+			claims = append(claims, stored.claim)
+		}
+	}
+	sortClaims(claims)
+	return claims, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return s.cache.Close()
+}
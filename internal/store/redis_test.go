@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	s, err := NewRedisStore("redis://"+server.Addr(), "lsk-faucet")
+	require.NoError(t, err)
+	return s, server
+}
+
+func TestRedisStore_Expiry(t *testing.T) {
+	s, server := newTestRedisStore(t)
+	defer s.Close()
+
+	_, ok, err := s.Reserve([]string{"address"}, time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.True(t, server.Exists("{lsk-faucet}:address"))
+
+	server.FastForward(30 * time.Minute)
+	remaining, ok, err := s.Reserve([]string{"address"}, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Minute, remaining)
+
+	server.FastForward(30 * time.Minute)
+	_, ok, err = s.Reserve([]string{"address"}, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisStore_SharedAcrossReplicas(t *testing.T) {
+	first, server := newTestRedisStore(t)
+	defer first.Close()
+	second, err := NewRedisStore("redis://"+server.Addr(), "lsk-faucet")
+	require.NoError(t, err)
+	defer second.Close()
+
+	_, ok, err := first.Reserve([]string{"address", "ip"}, time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = second.Reserve([]string{"other", "ip"}, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, server.Exists("{lsk-faucet}:other"))
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	s, server := newTestRedisStore(t)
+	defer s.Close()
+	server.Close()
+
+	_, ok, err := s.Reserve([]string{"address"}, time.Hour)
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
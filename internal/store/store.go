@@ -0,0 +1,103 @@
+package store
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Store keeps the rate limit keys, budget counters and queued claims of the
+// faucet.
+type Store interface {
+	// Reserve sets every key with the given ttl unless one of them is still
+	// set, in which case nothing is written and it returns the remaining ttl
+	// of the first such key and false. The check and the write are atomic.
+	Reserve(keys []string, ttl time.Duration) (time.Duration, bool, error)
+	// Release removes the keys, e.g. after a claim failed.
+	Release(keys ...string) error
+	// Spend adds every charge to its counter in the current window, unless a
+	// positive charge would take its counter above the limit. Then nothing is
+	// written and it returns the index of that charge and the time its window
+	// resets, otherwise it returns -1. The check and the write are atomic.
+	Spend(charges []Charge) (int, time.Time, error)
+	// Usage returns the amount counted by key in the current window and the
+	// time the window resets.
+	Usage(key string, window time.Duration) (*big.Int, time.Time, error)
+	// SaveClaim writes the claim, replacing the claim of the same ID.
+	// Unfinished claims are kept until they finish, other claims expire after
+	// ttl.
+	SaveClaim(claim Claim, ttl time.Duration) error
+	// StartClaim moves a queued claim to ClaimSending and returns it. It
+	// returns false when the claim is not queued, e.g. because another
+	// replica took it. The check and the write are atomic.
+	StartClaim(id string) (Claim, bool, error)
+	// Claim returns the claim of the ID and whether it exists.
+	Claim(id string) (Claim, bool, error)
+	// UnfinishedClaims returns the queued, sending and sent claims in the
+	// order they were created.
+	UnfinishedClaims() ([]Claim, error)
+	Close() error
+}
+
+// Charge adds Amount to the counter Key of the fixed window of length Window
+// containing At, or the current window when At is zero. A nil Limit leaves
+// the counter unbounded and a negative Amount refunds an earlier charge, in
+// the window of that charge.
+type Charge struct {
+	Key    string        `json:"key"`
+	Amount *big.Int      `json:"amount"`
+	Limit  *big.Int      `json:"limit,omitempty"`
+	Window time.Duration `json:"window"`
+	At     time.Time     `json:"at,omitempty"`
+}
+
+// windowKey returns the key of the counter the charge adds to and the time
+// its window ends.
+func (c Charge) windowKey(now time.Time) (string, time.Time) {
+	if !c.At.IsZero() {
+		now = c.At
+	}
+	return windowKey(c.Key, c.Window, now)
+}
+
+// clock returns the current time of the budget windows. Tests fix it, so
+// their windows do not roll over halfway.
+var clock = time.Now
+
+// windowKey returns the key of the counter of the window containing now and
+// the time that window ends. Windows are aligned to the Unix epoch, so daily
+// windows start at midnight UTC.
+func windowKey(key string, window time.Duration, now time.Time) (string, time.Time) {
+	start := now.Truncate(window)
+	return fmt.Sprintf("%s:%d", key, start.Unix()), start.Add(window)
+}
+
+// counter is the value of a budget counter and the time it expires.
+type counter struct {
+	key   string
+	value *big.Int
+	reset time.Time
+}
+
+// spend computes the counters after applying the charges on top of the
+// current values returned by get. It returns the index of the first charge
+// over its limit and the time its window resets, or -1.
+func spend(charges []Charge, now time.Time, get func(key string) (*big.Int, error)) ([]counter, int, time.Time, error) {
+	counters := make([]counter, 0, len(charges))
+	for i, charge := range charges {
+		key, reset := charge.windowKey(now)
+		used, err := get(key)
+		if err != nil {
+			return nil, 0, time.Time{}, err
+		}
+		value := new(big.Int).Add(used, charge.Amount)
+		if value.Sign() < 0 {
+			value.SetInt64(0)
+		}
+		if charge.Limit != nil && charge.Amount.Sign() > 0 && value.Cmp(charge.Limit) > 0 {
+			return nil, i, reset, nil
+		}
+		counters = append(counters, counter{key: key, value: value, reset: reset})
+	}
+	return counters, -1, time.Time{}, nil
+}
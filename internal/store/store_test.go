@@ -0,0 +1,292 @@
+package store
+
+import (
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	boltStore, err := NewBoltStore(filepath.Join(t.TempDir(), "faucet.db"))
+	require.NoError(t, err)
+	redisStore, _ := newTestRedisStore(t)
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"bolt":   boltStore,
+		"redis":  redisStore,
+	}
+	t.Cleanup(func() {
+		for _, s := range stores {
+			s.Close()
+		}
+	})
+	return stores
+}
+
+func TestStore_Reserve(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := s.Reserve([]string{"address", "ip"}, time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			remaining, ok, err := s.Reserve([]string{"other", "ip"}, 2*time.Hour)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.InDelta(t, time.Hour, remaining, float64(time.Second))
+
+			// A refused reservation must not write any of its keys
+			_, ok, err = s.Reserve([]string{"other"}, time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			require.NoError(t, s.Release("address", "ip", "unknown"))
+			_, ok, err = s.Reserve([]string{"address", "ip"}, time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	for name, s := range testStores(t) {
+		if name == "redis" {
+			// miniredis only expires keys when its clock is forwarded, see TestRedisStore_Expiry
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := s.Reserve([]string{"address"}, 50*time.Millisecond)
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			require.Eventually(t, func() bool {
+				_, ok, err := s.Reserve([]string{"address"}, time.Hour)
+				return err == nil && ok
+			}, 2*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestStore_ConcurrentReserve(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			reserved := 0
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, ok, err := s.Reserve([]string{"address", "ip"}, time.Hour); err == nil && ok {
+						mutex.Lock()
+						reserved++
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, 1, reserved)
+		})
+	}
+}
+
+func TestBoltStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faucet.db")
+	s, err := NewBoltStore(path)
+	require.NoError(t, err)
+	_, ok, err := s.Reserve([]string{"address"}, time.Hour)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = s.Reserve([]string{"expired"}, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, s.Close())
+
+	s, err = NewBoltStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	remaining, ok, err := s.Reserve([]string{"address"}, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.InDelta(t, time.Hour, remaining, float64(time.Second))
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, s.removeExpired(time.Now()))
+	require.NoError(t, s.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(limitsBucket).Get([]byte("expired")))
+		assert.NotNil(t, tx.Bucket(limitsBucket).Get([]byte("address")))
+		return nil
+	}))
+}
+
+// fixClock stops the clock of the budget windows in the middle of the next
+// hour, so no window rolls over during a test and every window resets after
+// the real time.
+func fixClock(t *testing.T) time.Time {
+	now := time.Now().Truncate(time.Hour).Add(90 * time.Minute)
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = time.Now })
+	return now
+}
+
+func TestStore_Spend(t *testing.T) {
+	now := fixClock(t)
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			// 10^30 overflows the 64-bit counters of most stores
+			limit, _ := new(big.Int).SetString("1000000000000000000000000000000", 10)
+			half := new(big.Int).Div(limit, big.NewInt(2))
+			charges := []Charge{
+				{Key: "claims", Amount: big.NewInt(1), Limit: big.NewInt(3), Window: time.Hour},
+				{Key: "tokens", Amount: half, Limit: limit, Window: 24 * time.Hour},
+			}
+
+			for i := 0; i < 2; i++ {
+				refused, _, err := s.Spend(charges)
+				require.NoError(t, err)
+				assert.Equal(t, -1, refused)
+			}
+			refused, reset, err := s.Spend(charges)
+			require.NoError(t, err)
+			assert.Equal(t, 1, refused)
+			assert.Equal(t, now.Truncate(24*time.Hour).Add(24*time.Hour), reset)
+
+			// A refused spend must not count any of its charges
+			used, reset, err := s.Usage("claims", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, big.NewInt(2), used)
+			assert.Equal(t, now.Truncate(time.Hour).Add(time.Hour), reset)
+
+			refund := []Charge{{Key: "tokens", Amount: new(big.Int).Neg(half), Window: 24 * time.Hour}}
+			refused, _, err = s.Spend(refund)
+			require.NoError(t, err)
+			assert.Equal(t, -1, refused)
+			used, _, err = s.Usage("tokens", 24*time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, half, used)
+
+			refused, _, err = s.Spend(charges)
+			require.NoError(t, err)
+			assert.Equal(t, -1, refused)
+			used, _, err = s.Usage("claims", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, big.NewInt(3), used)
+
+			// A refund of a charge counted in an earlier window leaves the current window alone
+			late := []Charge{{Key: "claims", Amount: big.NewInt(-1), Window: time.Hour, At: now.Add(-time.Hour)}}
+			refused, _, err = s.Spend(late)
+			require.NoError(t, err)
+			assert.Equal(t, -1, refused)
+			used, _, err = s.Usage("claims", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, big.NewInt(3), used)
+		})
+	}
+}
+
+func TestStore_ConcurrentSpend(t *testing.T) {
+	fixClock(t)
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			charges := []Charge{{Key: "claims", Amount: big.NewInt(1), Limit: big.NewInt(5), Window: time.Hour}}
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.Spend(charges) //nolint:errcheck
+				}()
+			}
+			wg.Wait()
+
+			used, _, err := s.Usage("claims", time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, big.NewInt(5), used)
+		})
+	}
+}
+
+func TestStore_Claims(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Millisecond)
+			first := Claim{ID: "b", Status: ClaimQueued, Type: "token", Address: "0x01", LimitKeys: []string{"0x01", "127.0.0.1"}, CreatedAt: now, UpdatedAt: now}
+			second := Claim{ID: "a", Status: ClaimQueued, Type: "native", Address: "0x02", CreatedAt: now.Add(time.Second), UpdatedAt: now}
+			require.NoError(t, s.SaveClaim(second, time.Hour))
+			require.NoError(t, s.SaveClaim(first, time.Hour))
+
+			claims, err := s.UnfinishedClaims()
+			require.NoError(t, err)
+			assert.Equal(t, []Claim{first, second}, claims)
+
+			started, ok, err := s.StartClaim("b")
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, ClaimSending, started.Status)
+			// A claim is only started once
+			_, ok, err = s.StartClaim("b")
+			require.NoError(t, err)
+			assert.False(t, ok)
+			_, ok, err = s.StartClaim("unknown")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			started.Status, started.TxHash, started.Amount, started.Batched = ClaimSent, "0xabc", "1000", true
+			started.Charges = []Charge{{Key: "budget:claims", Amount: big.NewInt(1), Limit: big.NewInt(10), Window: time.Hour, At: now}}
+			require.NoError(t, s.SaveClaim(started, time.Hour))
+			got, ok, err := s.Claim("b")
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, ClaimSent, got.Status)
+			assert.Equal(t, "0xabc", got.TxHash)
+			assert.Equal(t, "1000", got.Amount)
+			assert.True(t, got.Batched)
+			assert.Equal(t, started.Charges, got.Charges)
+			assert.Equal(t, first.LimitKeys, got.LimitKeys)
+
+			claims, err = s.UnfinishedClaims()
+			require.NoError(t, err)
+			assert.Equal(t, []Claim{got, second}, claims)
+
+			got.Status = ClaimConfirmed
+			require.NoError(t, s.SaveClaim(got, time.Hour))
+			claims, err = s.UnfinishedClaims()
+			require.NoError(t, err)
+			assert.Equal(t, []Claim{second}, claims)
+
+			_, ok, err = s.Claim("unknown")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestStore_ConcurrentStartClaim(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, s.SaveClaim(Claim{ID: "claim", Status: ClaimQueued, CreatedAt: time.Now()}, time.Hour))
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			started := 0
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, ok, err := s.StartClaim("claim"); err == nil && ok {
+						mutex.Lock()
+						started++
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, 1, started)
+		})
+	}
+}